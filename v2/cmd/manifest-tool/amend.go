@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var amendCmd = &cli.Command{
+	Name:      "amend",
+	Usage:     "add, replace or remove individual platforms in an existing manifest list/index",
+	ArgsUsage: "TARGET",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "add",
+			Usage: "image to add as IMAGE[=os/arch[/variant]]; replaces any existing entry for the same platform",
+		},
+		&cli.StringSliceFlag{
+			Name:  "remove",
+			Usage: "platform to remove as os/arch[/variant]; without a variant all variants are removed",
+		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "image manifest type: docker (v2.2 manifest list) or oci (v1 index); defaults to the type of the existing manifest list/index",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			logrus.Fatal("the amend command requires the manifest list/index reference to amend, following any options")
+		}
+		if len(c.StringSlice("add")) == 0 && len(c.StringSlice("remove")) == 0 {
+			logrus.Fatal("at least one --add or --remove option must be provided")
+		}
+
+		var add []types.ManifestEntry
+		for _, value := range c.StringSlice("add") {
+			entry := types.ManifestEntry{Image: value}
+			if i := strings.LastIndex(value, "="); i >= 0 {
+				platform, err := util.ParsePlatform(value[i+1:])
+				if err != nil {
+					logrus.Fatalf("invalid platform for --add %q: %v", value, err)
+				}
+				entry.Image, entry.Platform = value[:i], platform
+			}
+			add = append(add, entry)
+		}
+		var remove []ocispec.Platform
+		for _, value := range c.StringSlice("remove") {
+			platform, err := util.ParsePlatform(value)
+			if err != nil {
+				logrus.Fatalf("invalid platform for --remove: %v", err)
+			}
+			if strings.Count(value, "/") == 1 {
+				// no variant given; don't limit the removal to the normalized default variant
+				platform.Variant = ""
+			}
+			remove = append(remove, platform)
+		}
+
+		var manifestType *types.ManifestType
+		switch c.String("type") {
+		case "":
+		case "docker":
+			t := types.Docker
+			manifestType = &t
+		case "oci":
+			t := types.OCI
+			manifestType = &t
+		default:
+			logrus.Fatalf("unknown manifest type %q; must be docker or oci", c.String("type"))
+		}
+
+		manifestList, memoryStore, err := registry.AmendManifestList(c.String("username"), c.String("password"), c.Args().First(), add, remove,
+			c.Bool("insecure"), c.Bool("plain-http"), manifestType, c.String("docker-cfg"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		digest, length, err := registry.Push(manifestList, nil, memoryStore)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		fmt.Printf("Digest: %s %d\n", digest, length)
+		return nil
+	},
+}
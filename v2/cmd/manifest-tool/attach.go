@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var attachCmd = &cli.Command{
+	Name:      "attach",
+	Usage:     "attach files as an OCI artifact (e.g. an SBOM or test report) to an image or manifest list/index",
+	ArgsUsage: "NAME[:TAG|@DIGEST] [FILE[:MEDIATYPE]...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "artifact-type",
+			Usage:    "artifact type of the attached artifact, e.g. application/spdx+json",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "layer-media-type",
+			Value: "application/octet-stream",
+			Usage: "media type for files which do not specify one",
+		},
+		&cli.StringSliceFlag{
+			Name:  "annotation",
+			Usage: "annotation to set on the artifact manifest, as key=value (can be repeated)",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() < 1 {
+			logrus.Fatal("the attach command requires the image reference to attach the artifact to")
+		}
+		imageRef, err := util.ParseName(c.Args().First())
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		_, tagged := imageRef.(reference.NamedTagged)
+		_, digested := imageRef.(reference.Canonical)
+		if !tagged && !digested {
+			logrus.Fatal("image reference must include a tag or digest; manifest-tool does not default to 'latest'")
+		}
+
+		var files []types.ArtifactFile
+		for _, arg := range c.Args().Slice()[1:] {
+			file := types.ArtifactFile{
+				Path:      arg,
+				MediaType: c.String("layer-media-type"),
+			}
+			// only a suffix which looks like a media type is split off, keeping paths such as C:\sbom.json intact
+			if i := strings.LastIndex(arg, ":"); i > 0 && strings.Contains(arg[i+1:], "/") {
+				file.Path, file.MediaType = arg[:i], arg[i+1:]
+			}
+			files = append(files, file)
+		}
+
+		err = util.CreateRegistryHost(imageRef, c.String("username"), c.String("password"), c.Bool("insecure"),
+			c.Bool("plain-http"), c.String("docker-cfg"), true)
+		if err != nil {
+			return fmt.Errorf("error creating registry host configuration: %v", err)
+		}
+		resolver := util.GetResolver()
+		memoryStore := store.NewMemoryStore()
+		subject, err := registry.FetchDescriptor(resolver, memoryStore, imageRef)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		desc, err := registry.Attach(resolver, memoryStore, imageRef, subject, c.String("artifact-type"), files,
+			parseAnnotations(c.StringSlice("annotation")))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		fmt.Printf("Digest: %s %d\n", desc.Digest, desc.Size)
+		return nil
+	},
+}
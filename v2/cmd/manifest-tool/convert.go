@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var convertCmd = &cli.Command{
+	Name:      "convert",
+	Usage:     "re-push an existing manifest list/index as a Docker manifest list or OCI index",
+	ArgsUsage: "TARGET",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "to",
+			Usage:    "manifest type to convert to: docker (v2.2 manifest list) or oci (v1 index)",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "convert-manifests",
+			Usage: "also convert the media types of the platform-specific image manifests, configs and layers",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			logrus.Fatal("the convert command requires the manifest list/index reference to convert, following any options")
+		}
+		var manifestType types.ManifestType
+		switch c.String("to") {
+		case "docker":
+			manifestType = types.Docker
+		case "oci":
+			manifestType = types.OCI
+		default:
+			logrus.Fatalf("unknown manifest type %q; must be docker or oci", c.String("to"))
+		}
+
+		manifestList, memoryStore, err := registry.ConvertManifestList(c.String("username"), c.String("password"), c.Args().First(), manifestType,
+			c.Bool("convert-manifests"), c.Bool("insecure"), c.Bool("plain-http"), c.String("docker-cfg"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		digest, length, err := registry.Push(manifestList, nil, memoryStore)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		fmt.Printf("Digest: %s %d\n", digest, length)
+		return nil
+	},
+}
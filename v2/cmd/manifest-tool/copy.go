@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var copyCmd = &cli.Command{
+	Name:      "copy",
+	Usage:     "copy an image or manifest list/index, including all manifests and layers, to another repository or registry",
+	ArgsUsage: "SOURCE DESTINATION",
+	Flags: []cli.Flag{
+		copyReferrersFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			logrus.Fatal("the copy command requires a source and a destination image reference")
+		}
+		srcRef, err := util.ParseName(c.Args().Get(0))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		dstRef, err := util.ParseName(c.Args().Get(1))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		for _, ref := range []reference.Named{srcRef, dstRef} {
+			if reference.IsNameOnly(ref) {
+				logrus.Fatalf("image reference %s must include a tag; manifest-tool does not default to 'latest'", ref)
+			}
+		}
+
+		err = util.CreateRegistryHost(dstRef, c.String("username"), c.String("password"), c.Bool("insecure"),
+			c.Bool("plain-http"), c.String("docker-cfg"), true)
+		if err != nil {
+			return fmt.Errorf("error creating registry host configuration: %v", err)
+		}
+		if reference.Domain(srcRef) != reference.Domain(dstRef) {
+			// credentials and the client certificate provided on the command line are only used for the destination registry
+			err = util.CreateSourceRegistryHost(srcRef, c.Bool("insecure"), c.Bool("plain-http"), c.String("docker-cfg"))
+			if err != nil {
+				return fmt.Errorf("error creating registry host configuration: %v", err)
+			}
+		}
+
+		digest, length, err := registry.Copy(util.GetResolver(), store.NewMemoryStore(), srcRef, dstRef, c.Bool("copy-referrers"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		fmt.Printf("Digest: %s %d\n", digest, length)
+		return nil
+	},
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var diffCmd = &cli.Command{
+	Name:      "diff",
+	Usage:     "compare two images or manifest lists/indexes: platforms, manifest digests, layers, config and annotations",
+	ArgsUsage: "REF1 REF2",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "raw",
+			Usage: "raw JSON output",
+		},
+		&cli.BoolFlag{
+			Name:  "exit-code",
+			Usage: "exit with status 1 if any difference is found",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			logrus.Fatal("the diff command requires two image references")
+		}
+		var refs []reference.Named
+		for _, name := range []string{c.Args().Get(0), c.Args().Get(1)} {
+			ref, err := util.ParseName(name)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			_, tagged := ref.(reference.NamedTagged)
+			_, digested := ref.(reference.Canonical)
+			if !tagged && !digested {
+				logrus.Fatalf("image reference %s must include a tag or digest; manifest-tool does not default to 'latest'", name)
+			}
+			refs = append(refs, ref)
+		}
+
+		err := util.CreateRegistryHost(refs[0], c.String("username"), c.String("password"), c.Bool("insecure"),
+			c.Bool("plain-http"), c.String("docker-cfg"), false)
+		if err != nil {
+			return fmt.Errorf("error creating registry host configuration: %v", err)
+		}
+		if reference.Domain(refs[0]) != reference.Domain(refs[1]) {
+			// credentials and the client certificate provided on the command line are only used for the registry of the first image
+			err = util.CreateSourceRegistryHost(refs[1], c.Bool("insecure"), c.Bool("plain-http"), c.String("docker-cfg"))
+			if err != nil {
+				return fmt.Errorf("error creating registry host configuration: %v", err)
+			}
+		}
+
+		resolver := util.GetResolver()
+		memoryStore := store.NewMemoryStore()
+		desc1, err := registry.FetchDescriptor(resolver, memoryStore, refs[0])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		desc2, err := registry.FetchDescriptor(resolver, memoryStore, refs[1])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		result, err := registry.Diff(memoryStore, c.Args().Get(0), desc1, c.Args().Get(1), desc2)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		if c.Bool("raw") {
+			out, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			fmt.Println(string(out))
+		} else {
+			outputDiff(result)
+		}
+		if status := diffExitStatus(result, c.Bool("exit-code")); status != 0 {
+			os.Exit(status)
+		}
+		return nil
+	},
+}
+
+// diffExitStatus returns the exit status of the diff command: with --exit-code, 1 when
+// any difference was found, otherwise 0
+func diffExitStatus(result types.ImageDiff, exitCode bool) int {
+	if exitCode && !result.Equivalent {
+		return 1
+	}
+	return 0
+}
+
+func outputDiff(result types.ImageDiff) {
+	var (
+		yellow = color.New(color.Bold, color.FgYellow).SprintFunc()
+		red    = color.New(color.Bold, color.FgRed).SprintFunc()
+		green  = color.New(color.Bold, color.FgGreen).SprintFunc()
+	)
+	fmt.Printf("--- %s (%s)\n", result.Name1, yellow(result.Digest1))
+	fmt.Printf("+++ %s (%s)\n", result.Name2, yellow(result.Digest2))
+	if result.Identical {
+		fmt.Println("Identical: both references have the same digest")
+		return
+	}
+	if len(result.Annotations) > 0 {
+		fmt.Println("Annotations:")
+		outputChanges("  ", result.Annotations)
+	}
+	for _, platform := range result.OnlyIn1 {
+		fmt.Printf("%s %s: only in %s\n", red("-"), platform, result.Name1)
+	}
+	for _, platform := range result.OnlyIn2 {
+		fmt.Printf("%s %s: only in %s\n", green("+"), platform, result.Name2)
+	}
+	for _, platform := range result.Platforms {
+		if platform.Identical {
+			fmt.Printf("  %s: identical (%s)\n", platform.Platform, yellow(platform.Digest1))
+			continue
+		}
+		fmt.Printf("~ %s: %s -> %s\n", platform.Platform, yellow(platform.Digest1), yellow(platform.Digest2))
+		fmt.Printf("    Layers: %d shared, %d added, %d removed\n", len(platform.LayersShared), len(platform.LayersAdded), len(platform.LayersRemoved))
+		for _, layer := range platform.LayersRemoved {
+			fmt.Printf("    %s %s\n", red("-"), layer)
+		}
+		for _, layer := range platform.LayersAdded {
+			fmt.Printf("    %s %s\n", green("+"), layer)
+		}
+		if len(platform.Config) > 0 {
+			fmt.Println("    Config:")
+			outputChanges("      ", platform.Config)
+		}
+		if len(platform.Annotations) > 0 {
+			fmt.Println("    Annotations:")
+			outputChanges("      ", platform.Annotations)
+		}
+	}
+	if result.Equivalent {
+		fmt.Println("Equivalent: no differences in platforms, layers, config or annotations")
+	}
+}
+
+// outputChanges prints each changed setting as removed (-), added (+) or changed (~)
+func outputChanges(indent string, changes []types.ValueChange) {
+	var (
+		red   = color.New(color.Bold, color.FgRed).SprintFunc()
+		green = color.New(color.Bold, color.FgGreen).SprintFunc()
+		blue  = color.New(color.Bold, color.FgBlue).SprintFunc()
+	)
+	for _, change := range changes {
+		switch {
+		case change.To == nil:
+			fmt.Printf("%s%s %s: %q\n", indent, red("-"), change.Key, *change.From)
+		case change.From == nil:
+			fmt.Printf("%s%s %s: %q\n", indent, green("+"), change.Key, *change.To)
+		default:
+			fmt.Printf("%s%s %s: %q -> %q\n", indent, blue("~"), change.Key, *change.From, *change.To)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+)
+
+func TestDiffExitStatus(t *testing.T) {
+	var tests = []struct {
+		name     string
+		result   types.ImageDiff
+		exitCode bool
+		status   int
+	}{
+		{name: "identical", result: types.ImageDiff{Identical: true, Equivalent: true}, exitCode: true},
+		{name: "equivalent", result: types.ImageDiff{Equivalent: true}, exitCode: true},
+		{name: "different", result: types.ImageDiff{OnlyIn1: []string{"linux/s390x"}}, exitCode: true, status: 1},
+		{name: "different without exit code", result: types.ImageDiff{OnlyIn1: []string{"linux/s390x"}}},
+	}
+	for _, test := range tests {
+		if status := diffExitStatus(test.result, test.exitCode); status != test.status {
+			t.Errorf("%s: expected exit status %d, got %d", test.name, test.status, status)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// inspectResult is the data model of the inspect --format output. For a manifest list/index,
+// Manifests holds each of its entries; for a single image manifest, it holds the image itself.
+type inspectResult struct {
+	Name        string            `json:"name" yaml:"name"`
+	Digest      string            `json:"digest" yaml:"digest"`
+	MediaType   string            `json:"mediaType" yaml:"mediaType"`
+	Size        int64             `json:"size" yaml:"size"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	Manifests   []inspectManifest `json:"manifests" yaml:"manifests"`
+}
+
+// inspectManifest describes an image or attestation manifest; AttestationFor is the digest
+// of the image manifest an attestation manifest refers to
+type inspectManifest struct {
+	Digest         string            `json:"digest" yaml:"digest"`
+	MediaType      string            `json:"mediaType" yaml:"mediaType"`
+	Size           int64             `json:"size" yaml:"size"`
+	Platform       inspectPlatform   `json:"platform" yaml:"platform"`
+	Attestation    bool              `json:"attestation" yaml:"attestation"`
+	AttestationFor string            `json:"attestationFor,omitempty" yaml:"attestationFor,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	Config         inspectConfig     `json:"config" yaml:"config"`
+	Layers         []inspectLayer    `json:"layers" yaml:"layers"`
+}
+
+type inspectPlatform struct {
+	OS           string   `json:"os" yaml:"os"`
+	Architecture string   `json:"architecture" yaml:"architecture"`
+	Variant      string   `json:"variant,omitempty" yaml:"variant,omitempty"`
+	OSVersion    string   `json:"osVersion,omitempty" yaml:"osVersion,omitempty"`
+	OSFeatures   []string `json:"osFeatures,omitempty" yaml:"osFeatures,omitempty"`
+}
+
+// inspectConfig describes the config of an image manifest; the image fields are empty when
+// the config is not an image config (e.g. for attestation manifests)
+type inspectConfig struct {
+	Digest     string            `json:"digest" yaml:"digest"`
+	MediaType  string            `json:"mediaType" yaml:"mediaType"`
+	Size       int64             `json:"size" yaml:"size"`
+	Created    string            `json:"created,omitempty" yaml:"created,omitempty"`
+	Author     string            `json:"author,omitempty" yaml:"author,omitempty"`
+	User       string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Env        []string          `json:"env,omitempty" yaml:"env,omitempty"`
+	Entrypoint []string          `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	Cmd        []string          `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	WorkingDir string            `json:"workingDir,omitempty" yaml:"workingDir,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+type inspectLayer struct {
+	Digest      string            `json:"digest" yaml:"digest"`
+	MediaType   string            `json:"mediaType" yaml:"mediaType"`
+	Size        int64             `json:"size" yaml:"size"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// newInspectResult builds the inspect data model for the descriptor from the memory store
+func newInspectResult(name string, descriptor ocispec.Descriptor, ms *store.MemoryStore) (inspectResult, error) {
+	result := inspectResult{
+		Name:      name,
+		Digest:    descriptor.Digest.String(),
+		MediaType: descriptor.MediaType,
+		Size:      descriptor.Size,
+		Manifests: []inspectManifest{},
+	}
+	_, db, _ := ms.Get(descriptor)
+	switch descriptor.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		var idx ocispec.Index
+		if err := json.Unmarshal(db, &idx); err != nil {
+			return inspectResult{}, err
+		}
+		result.Annotations = idx.Annotations
+		for _, desc := range idx.Manifests {
+			switch desc.MediaType {
+			case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+			default:
+				return inspectResult{}, fmt.Errorf("unknown media type for further display: %s", desc.MediaType)
+			}
+			man, err := newInspectManifest(desc, ms)
+			if err != nil {
+				return inspectResult{}, err
+			}
+			result.Manifests = append(result.Manifests, man)
+		}
+	case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+		man, err := newInspectManifest(descriptor, ms)
+		if err != nil {
+			return inspectResult{}, err
+		}
+		result.Annotations = man.Annotations
+		result.Manifests = append(result.Manifests, man)
+	default:
+		return inspectResult{}, fmt.Errorf("unknown descriptor type: %s", descriptor.MediaType)
+	}
+	return result, nil
+}
+
+// newInspectManifest builds the inspect data model of an image or attestation manifest; the
+// platform of a single image manifest, which has no index entry, is read from its config
+func newInspectManifest(desc ocispec.Descriptor, ms *store.MemoryStore) (inspectManifest, error) {
+	_, db, _ := ms.Get(desc)
+	var man ocispec.Manifest
+	if err := json.Unmarshal(db, &man); err != nil {
+		return inspectManifest{}, err
+	}
+	result := inspectManifest{
+		Digest:      desc.Digest.String(),
+		MediaType:   desc.MediaType,
+		Size:        desc.Size,
+		Attestation: desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest",
+		Annotations: man.Annotations,
+		Config: inspectConfig{
+			Digest:    man.Config.Digest.String(),
+			MediaType: man.Config.MediaType,
+			Size:      man.Config.Size,
+		},
+		Layers: []inspectLayer{},
+	}
+	if result.Attestation {
+		result.AttestationFor = desc.Annotations["vnd.docker.reference.digest"]
+	}
+	for _, layer := range man.Layers {
+		result.Layers = append(result.Layers, inspectLayer{
+			Digest:      layer.Digest.String(),
+			MediaType:   layer.MediaType,
+			Size:        layer.Size,
+			Annotations: layer.Annotations,
+		})
+	}
+
+	var conf ocispec.Image
+	if _, cb, found := ms.Get(man.Config); found && !result.Attestation {
+		if err := json.Unmarshal(cb, &conf); err != nil {
+			return inspectManifest{}, err
+		}
+		if conf.Created != nil {
+			result.Config.Created = conf.Created.Format(time.RFC3339)
+		}
+		result.Config.Author = conf.Author
+		result.Config.User = conf.Config.User
+		result.Config.Env = conf.Config.Env
+		result.Config.Entrypoint = conf.Config.Entrypoint
+		result.Config.Cmd = conf.Config.Cmd
+		result.Config.WorkingDir = conf.Config.WorkingDir
+		result.Config.Labels = conf.Config.Labels
+	}
+	platform := desc.Platform
+	if platform == nil {
+		platform = &conf.Platform
+	}
+	result.Platform = inspectPlatform{
+		OS:           platform.OS,
+		Architecture: platform.Architecture,
+		Variant:      platform.Variant,
+		OSVersion:    platform.OSVersion,
+		OSFeatures:   platform.OSFeatures,
+	}
+	return result, nil
+}
+
+// writeFormatted writes the inspect result as a table, JSON, YAML, or using the format
+// string as a Go template, as with "docker inspect --format"
+func writeFormatted(w io.Writer, format string, result inspectResult) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "DIGEST\tPLATFORM\tMEDIA TYPE\tSIZE\tLAYERS")
+		for _, man := range result.Manifests {
+			platform := platforms.Format(ocispec.Platform{
+				OS:           man.Platform.OS,
+				Architecture: man.Platform.Architecture,
+				Variant:      man.Platform.Variant,
+			})
+			if man.Attestation {
+				platform = "attestation"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", man.Digest, platform, man.MediaType, man.Size, len(man.Layers))
+		}
+		return tw.Flush()
+	case "json":
+		out, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join": strings.Join,
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("invalid format template: %v", err)
+	}
+	if err := tmpl.Execute(w, result); err != nil {
+		return fmt.Errorf("unable to execute format template: %v", err)
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// formatInspect writes the inspect result for the descriptor to stdout in the requested format
+func formatInspect(name string, descriptor ocispec.Descriptor, format string, ms *store.MemoryStore) error {
+	result, err := newInspectResult(name, descriptor, ms)
+	if err != nil {
+		return err
+	}
+	return writeFormatted(os.Stdout, format, result)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// storeJSON stores the JSON encoding of v in the memory store and returns its descriptor
+func storeJSON(t *testing.T, ms *store.MemoryStore, mediaType string, v interface{}, platform *ocispec.Platform) ocispec.Descriptor {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(b),
+		Size:      int64(len(b)),
+		Platform:  platform,
+	}
+	ms.Set(desc, b)
+	return desc
+}
+
+// testInspectIndex stores an index with an amd64 image, an arm/v7 image and an attestation
+// manifest of the amd64 image, and returns the index and amd64 image descriptors
+func testInspectIndex(t *testing.T, ms *store.MemoryStore) (ocispec.Descriptor, ocispec.Descriptor) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	image := func(platform ocispec.Platform, config ocispec.ImageConfig, layers ...string) ocispec.Descriptor {
+		man := ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config: storeJSON(t, ms, ocispec.MediaTypeImageConfig, ocispec.Image{
+				Created:  &created,
+				Author:   "builder",
+				Platform: platform,
+				Config:   config,
+			}, nil),
+		}
+		for _, layer := range layers {
+			man.Layers = append(man.Layers, ocispec.Descriptor{
+				MediaType: ocispec.MediaTypeImageLayerGzip,
+				Digest:    digest.FromString(layer),
+				Size:      int64(len(layer)),
+			})
+		}
+		return storeJSON(t, ms, ocispec.MediaTypeImageManifest, man, &platform)
+	}
+	amd64 := image(ocispec.Platform{OS: "linux", Architecture: "amd64"}, ocispec.ImageConfig{
+		Env:    []string{"PATH=/bin"},
+		Cmd:    []string{"app"},
+		Labels: map[string]string{"version": "1"},
+	}, "base", "app")
+	armv7 := image(ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, ocispec.ImageConfig{}, "base-arm")
+	attestation := storeJSON(t, ms, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromString("{}"), Size: 2},
+		Layers: []ocispec.Descriptor{{
+			MediaType: "application/vnd.in-toto+json",
+			Digest:    digest.FromString("statement"),
+			Size:      9,
+		}},
+	}, &ocispec.Platform{OS: "unknown", Architecture: "unknown"})
+	attestation.Annotations = map[string]string{
+		"vnd.docker.reference.type":   "attestation-manifest",
+		"vnd.docker.reference.digest": amd64.Digest.String(),
+	}
+	index := storeJSON(t, ms, ocispec.MediaTypeImageIndex, ocispec.Index{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   ocispec.MediaTypeImageIndex,
+		Manifests:   []ocispec.Descriptor{amd64, armv7, attestation},
+		Annotations: map[string]string{"org.opencontainers.image.revision": "abc"},
+	}, nil)
+	return index, amd64
+}
+
+func TestNewInspectResult(t *testing.T) {
+	ms := store.NewMemoryStore()
+	index, amd64 := testInspectIndex(t, ms)
+
+	result, err := newInspectResult("myregistry.io/app:v1", index, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "myregistry.io/app:v1" || result.Digest != index.Digest.String() || result.MediaType != ocispec.MediaTypeImageIndex {
+		t.Errorf("unexpected index: %+v", result)
+	}
+	if result.Annotations["org.opencontainers.image.revision"] != "abc" {
+		t.Errorf("expected the index annotations, got %v", result.Annotations)
+	}
+	if len(result.Manifests) != 3 {
+		t.Fatalf("expected 3 manifests, got %d", len(result.Manifests))
+	}
+	man := result.Manifests[0]
+	if man.Digest != amd64.Digest.String() || man.Platform.Architecture != "amd64" || man.Attestation || len(man.Layers) != 2 {
+		t.Errorf("unexpected amd64 manifest: %+v", man)
+	}
+	expectedConfig := inspectConfig{
+		Digest:    man.Config.Digest,
+		MediaType: ocispec.MediaTypeImageConfig,
+		Size:      man.Config.Size,
+		Created:   "2024-05-01T12:00:00Z",
+		Author:    "builder",
+		Env:       []string{"PATH=/bin"},
+		Cmd:       []string{"app"},
+		Labels:    map[string]string{"version": "1"},
+	}
+	if !reflect.DeepEqual(man.Config, expectedConfig) {
+		t.Errorf("expected config %+v, got %+v", expectedConfig, man.Config)
+	}
+	if man := result.Manifests[1]; man.Platform.Architecture != "arm" || man.Platform.Variant != "v7" {
+		t.Errorf("unexpected arm manifest platform: %+v", man.Platform)
+	}
+	if man := result.Manifests[2]; !man.Attestation || man.AttestationFor != amd64.Digest.String() || man.Config.Created != "" {
+		t.Errorf("unexpected attestation manifest: %+v", man)
+	}
+
+	// the platform of a single image manifest is read from its config
+	amd64.Platform = nil
+	result, err = newInspectResult("myregistry.io/app:v1-amd64", amd64, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Manifests) != 1 || result.Manifests[0].Platform.OS != "linux" || result.Manifests[0].Platform.Architecture != "amd64" {
+		t.Errorf("unexpected single image manifest result: %+v", result.Manifests)
+	}
+
+	if _, err := newInspectResult("artifact", ocispec.Descriptor{MediaType: "application/vnd.example+json"}, ms); err == nil {
+		t.Error("expected error for an unknown media type")
+	}
+}
+
+func TestWriteFormatted(t *testing.T) {
+	ms := store.NewMemoryStore()
+	index, amd64 := testInspectIndex(t, ms)
+	result, err := newInspectResult("myregistry.io/app:v1", index, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeFormatted(&buf, "table", result); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "DIGEST") {
+		t.Fatalf("expected a header and 3 rows, got:\n%s", buf.String())
+	}
+	for i, expected := range [][]string{
+		{amd64.Digest.String(), "linux/amd64", ocispec.MediaTypeImageManifest, "2"},
+		{"linux/arm/v7", "1"},
+		{"attestation", "1"},
+	} {
+		fields := strings.Fields(lines[i+1])
+		for _, field := range expected {
+			found := false
+			for _, f := range fields {
+				found = found || f == field
+			}
+			if !found {
+				t.Errorf("expected %q in table row %q", field, lines[i+1])
+			}
+		}
+	}
+
+	buf.Reset()
+	if err := writeFormatted(&buf, "json", result); err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON inspectResult
+	if err := json.Unmarshal(buf.Bytes(), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON, result) {
+		t.Errorf("expected the JSON output to decode to\n%+v\ngot\n%+v", result, fromJSON)
+	}
+
+	buf.Reset()
+	if err := writeFormatted(&buf, "yaml", result); err != nil {
+		t.Fatal(err)
+	}
+	var fromYAML inspectResult
+	if err := yaml.Unmarshal(buf.Bytes(), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromYAML, result) {
+		t.Errorf("expected the YAML output to decode to\n%+v\ngot\n%+v", result, fromYAML)
+	}
+
+	var tests = []struct {
+		format   string
+		expected string
+	}{
+		{format: "{{.Name}} {{len .Manifests}}", expected: "myregistry.io/app:v1 3\n"},
+		{format: "{{range .Manifests}}{{.Platform.Architecture}} {{end}}", expected: "amd64 arm unknown \n"},
+		{format: "{{json .Annotations}}", expected: `{"org.opencontainers.image.revision":"abc"}` + "\n"},
+		{format: `{{join (index .Manifests 0).Config.Cmd ","}}`, expected: "app\n"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		if err := writeFormatted(&buf, test.format, result); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.format, err)
+			continue
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.format, test.expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := writeFormatted(&buf, "{{", result); err == nil || !strings.Contains(err.Error(), "invalid format template") {
+		t.Errorf("expected an invalid template error, got %v", err)
+	}
+	if err := writeFormatted(&buf, "{{.Missing}}", result); err == nil || !strings.Contains(err.Error(), "unable to execute format template") {
+		t.Errorf("expected a template execution error, got %v", err)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/docker/distribution/reference"
 	"github.com/estesp/manifest-tool/v2/pkg/registry"
@@ -11,15 +15,19 @@ import (
 	"github.com/estesp/manifest-tool/v2/pkg/types"
 	"github.com/estesp/manifest-tool/v2/pkg/util"
 
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
 	"github.com/fatih/color"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
 var inspectCmd = &cli.Command{
-	Name:  "inspect",
-	Usage: "fetch image manifests in a container registry",
+	Name:      "inspect",
+	Usage:     "fetch image manifests in a container registry",
+	ArgsUsage: "NAME[:TAG|@DIGEST|:TAG@DIGEST]",
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
 			Name:  "raw",
@@ -29,6 +37,18 @@ var inspectCmd = &cli.Command{
 			Name:  "expand-config",
 			Usage: "expand image config content in raw JSON output",
 		},
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "also show the image config (entrypoint, cmd, env, ports, user, working dir, labels, created time and history) of each image",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: table, json, yaml, or a Go template (e.g. '{{range .Manifests}}{{.Platform.Architecture}} {{end}}')",
+		},
+		&cli.StringFlag{
+			Name:  "platform",
+			Usage: "only output the image a runtime would select from a manifest list/index for this platform (os[(osversion)]/arch[/variant])",
+		},
 	},
 	Action: func(c *cli.Context) error {
 
@@ -37,13 +57,21 @@ var inspectCmd = &cli.Command{
 		if err != nil {
 			logrus.Fatal(err)
 		}
-		if _, ok := imageRef.(reference.NamedTagged); !ok {
-			logrus.Fatal("image reference must include a tag; manifest-tool does not default to 'latest'")
+		_, tagged := imageRef.(reference.NamedTagged)
+		_, digested := imageRef.(reference.Canonical)
+		if !tagged && !digested {
+			logrus.Fatal("image reference must include a tag or digest; manifest-tool does not default to 'latest'")
 		}
 
 		if c.Bool("expand-config") && !c.Bool("raw") {
 			logrus.Fatal("the --expand-config flag is only valid when used with --raw")
 		}
+		if c.Bool("raw") && c.String("format") != "" {
+			logrus.Fatal("the --raw flag cannot be combined with --format")
+		}
+		if c.Bool("verbose") && (c.Bool("raw") || c.String("format") != "") {
+			logrus.Fatal("the --verbose flag is only valid for the default human-readable output")
+		}
 		memoryStore := store.NewMemoryStore()
 		err = util.CreateRegistryHost(imageRef, c.String("username"), c.String("password"), c.Bool("insecure"),
 			c.Bool("plain-http"), c.String("docker-cfg"), false)
@@ -51,11 +79,24 @@ var inspectCmd = &cli.Command{
 			return fmt.Errorf("error creating registry host configuration: %v", err)
 		}
 
-		descriptor, err := registry.FetchDescriptor(util.GetResolver(), memoryStore, imageRef)
+		resolver := util.GetResolver()
+		descriptor, err := registry.FetchDescriptor(resolver, memoryStore, imageRef)
 		if err != nil {
-			logrus.Error(err)
+			logrus.Fatal(err)
+		}
+		if c.String("platform") != "" {
+			descriptor, err = selectPlatform(memoryStore, descriptor, c.String("platform"))
+			if err != nil {
+				logrus.Fatal(err)
+			}
 		}
 
+		if format := c.String("format"); format != "" {
+			if err := formatInspect(name, descriptor, format, memoryStore); err != nil {
+				logrus.Fatal(err)
+			}
+			return nil
+		}
 		if c.Bool("raw") {
 			out, err := generateRawJSON(name, descriptor, c.Bool("expand-config"), memoryStore)
 			if err != nil {
@@ -72,7 +113,11 @@ var inspectCmd = &cli.Command{
 			if err := json.Unmarshal(db, &idx); err != nil {
 				logrus.Fatal(err)
 			}
-			outputList(name, memoryStore, descriptor, idx)
+			fetcher, err := resolver.Fetcher(context.Background(), imageRef.String())
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			outputList(name, memoryStore, fetcher, descriptor, idx, c.Bool("verbose"))
 		case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
 			var man ocispec.Manifest
 			if err := json.Unmarshal(db, &man); err != nil {
@@ -83,7 +128,7 @@ var inspectCmd = &cli.Command{
 			if err := json.Unmarshal(cb, &conf); err != nil {
 				logrus.Fatal(err)
 			}
-			outputImage(name, descriptor, man, conf)
+			outputImage(name, descriptor, man, conf, c.Bool("verbose"))
 		default:
 			logrus.Errorf("Unknown descriptor type: %s", descriptor.MediaType)
 		}
@@ -92,7 +137,7 @@ var inspectCmd = &cli.Command{
 	},
 }
 
-func outputList(name string, cs *store.MemoryStore, descriptor ocispec.Descriptor, index ocispec.Index) {
+func outputList(name string, cs *store.MemoryStore, fetcher remotes.Fetcher, descriptor ocispec.Descriptor, index ocispec.Index, verbose bool) {
 	var (
 		yellow = color.New(color.Bold, color.FgYellow).SprintFunc()
 		red    = color.New(color.Bold, color.FgRed).SprintFunc()
@@ -127,25 +172,68 @@ func outputList(name string, cs *store.MemoryStore, descriptor ocispec.Descripto
 			if len(attestationDetail) > 0 {
 				// only output info about the attestation info
 				attestRef := img.Annotations["vnd.docker.reference.digest"]
-				outputStr.WriteString(fmt.Sprintf("[%d]       >>> Attestation for digest: %s\n\n", i+1, yellow(attestRef)))
+				outputStr.WriteString(fmt.Sprintf("[%d]       >>> Attestation for digest: %s\n", i+1, yellow(attestRef)))
+				for _, layer := range man.Layers {
+					predicateType := registry.PredicateType(layer)
+					if predicateType == "" {
+						continue
+					}
+					outputStr.WriteString(fmt.Sprintf("[%d]   Predicate: %s\n", i+1, green(predicateType)))
+					if !registry.IsProvenance(predicateType) {
+						continue
+					}
+					provenance, err := registry.FetchProvenance(context.Background(), fetcher, layer)
+					if err != nil {
+						logrus.Warnf("unable to read provenance of attestation %s: %v", img.Digest.String(), err)
+						continue
+					}
+					outputStr.WriteString(fmt.Sprintf("[%d]     Builder: %s\n", i+1, green(provenance.BuilderID)))
+					for _, material := range provenance.Materials {
+						var digests []string
+						for alg, value := range material.Digest {
+							digests = append(digests, alg+":"+value)
+						}
+						sort.Strings(digests)
+						outputStr.WriteString(fmt.Sprintf("[%d]    Material: %s %s\n", i+1, material.URI, yellow(strings.Join(digests, " "))))
+					}
+				}
+				outputStr.WriteString("\n")
 				continue
 			}
-			outputStr.WriteString(fmt.Sprintf("[%d] Platform:\n", i+1))
-			outputStr.WriteString(fmt.Sprintf("[%d]    -      OS: %s\n", i+1, green(img.Platform.OS)))
-			if img.Platform.OSVersion != "" {
-				outputStr.WriteString(fmt.Sprintf("[%d]    - OS Vers: %s\n", i+1, green(img.Platform.OSVersion)))
-			}
-			if len(img.Platform.OSFeatures) > 0 {
-				outputStr.WriteString(fmt.Sprintf("[%d]    - OS Feat: %s\n", i+1, green(img.Platform.OSFeatures)))
-			}
-			outputStr.WriteString(fmt.Sprintf("[%d]    -    Arch: %s\n", i+1, green(img.Platform.Architecture)))
-			if img.Platform.Variant != "" {
-				outputStr.WriteString(fmt.Sprintf("[%d]    - Variant: %s\n", i+1, green(img.Platform.Variant)))
+			if img.Platform == nil {
+				// the platform of an index entry is optional
+				outputStr.WriteString(fmt.Sprintf("[%d] Platform: %s\n", i+1, green("(none)")))
+			} else {
+				outputStr.WriteString(fmt.Sprintf("[%d] Platform:\n", i+1))
+				outputStr.WriteString(fmt.Sprintf("[%d]    -      OS: %s\n", i+1, green(img.Platform.OS)))
+				if img.Platform.OSVersion != "" {
+					outputStr.WriteString(fmt.Sprintf("[%d]    - OS Vers: %s\n", i+1, green(img.Platform.OSVersion)))
+				}
+				if len(img.Platform.OSFeatures) > 0 {
+					outputStr.WriteString(fmt.Sprintf("[%d]    - OS Feat: %s\n", i+1, green(img.Platform.OSFeatures)))
+				}
+				outputStr.WriteString(fmt.Sprintf("[%d]    -    Arch: %s\n", i+1, green(img.Platform.Architecture)))
+				if img.Platform.Variant != "" {
+					outputStr.WriteString(fmt.Sprintf("[%d]    - Variant: %s\n", i+1, green(img.Platform.Variant)))
+				}
 			}
 			outputStr.WriteString(fmt.Sprintf("[%d] # Layers: %s\n", i+1, red(len(man.Layers))))
+			outputStr.WriteString(fmt.Sprintf("[%d]    Total: %s (compressed layers)\n", i+1, blue(layersSize(man))))
 			for j, layer := range man.Layers {
 				outputStr.WriteString(fmt.Sprintf("     layer %s: digest = %s\n", red(fmt.Sprintf("%02d", j+1)), yellow(layer.Digest)))
 				outputStr.WriteString(fmt.Sprintf("                 type = %s\n", green(layer.MediaType)))
+				outputStr.WriteString(fmt.Sprintf("                 size = %s\n", blue(layer.Size)))
+			}
+			if verbose {
+				conf, err := readConfig(cs, fetcher, man.Config)
+				if err != nil {
+					logrus.Warnf("unable to read config of image %s: %v", img.Digest.String(), err)
+				} else {
+					outputStr.WriteString(fmt.Sprintf("[%d]   Config: %s\n", i+1, yellow(man.Config.Digest)))
+					for _, detail := range configDetails(conf) {
+						outputStr.WriteString(fmt.Sprintf("[%d]    - %10s: %s\n", i+1, detail[0], green(detail[1])))
+					}
+				}
 			}
 			outputStr.WriteString("\n")
 		default:
@@ -164,9 +252,13 @@ func outputList(name string, cs *store.MemoryStore, descriptor ocispec.Descripto
 	fmt.Printf(" * Contains %s manifest references (%s %s, %s %s):\n", red(len(index.Manifests)),
 		red(imageCount), imageStr, red(attestations), attestStr)
 	fmt.Printf("%s", outputStr.String())
+	if sizes := indexSizeSummary(cs, index); len(sizes.Platforms) > 1 {
+		fmt.Printf(" * Compressed layers: %s bytes in total, %s bytes shared across platforms, %s bytes unique to one platform\n",
+			blue(sizes.Total), blue(sizes.Shared), blue(sizes.Unique))
+	}
 }
 
-func outputImage(name string, descriptor ocispec.Descriptor, manifest ocispec.Manifest, config ocispec.Image) {
+func outputImage(name string, descriptor ocispec.Descriptor, manifest ocispec.Manifest, config ocispec.Image, verbose bool) {
 	var (
 		yellow = color.New(color.Bold, color.FgYellow).SprintFunc()
 		red    = color.New(color.Bold, color.FgRed).SprintFunc()
@@ -178,9 +270,216 @@ func outputImage(name string, descriptor ocispec.Descriptor, manifest ocispec.Ma
 	fmt.Printf("        Size: %s\n", blue(descriptor.Size))
 	fmt.Printf("          OS: %s\n", green(config.OS))
 	fmt.Printf("        Arch: %s\n", green(config.Architecture))
+	if config.Variant != "" {
+		fmt.Printf("     Variant: %s\n", green(config.Variant))
+	}
+	if config.OSVersion != "" {
+		fmt.Printf("     OS Vers: %s\n", green(config.OSVersion))
+	}
 	fmt.Printf("    # Layers: %s\n", red(len(manifest.Layers)))
+	fmt.Printf("  Total Size: %s (compressed layers)\n", blue(layersSize(manifest)))
 	for i, layer := range manifest.Layers {
 		fmt.Printf("      layer %s: digest = %s\n", red(fmt.Sprintf("%02d", i+1)), yellow(layer.Digest))
+		fmt.Printf("                  size = %s\n", blue(layer.Size))
+	}
+	if verbose {
+		fmt.Printf("      Config: %s\n", yellow(manifest.Config.Digest))
+		for _, detail := range configDetails(config) {
+			fmt.Printf("%12s: %s\n", detail[0], green(detail[1]))
+		}
+	}
+}
+
+// readConfig returns the image config from the memory store, fetching it from the registry
+// if it is not already present
+func readConfig(cs *store.MemoryStore, fetcher remotes.Fetcher, desc ocispec.Descriptor) (ocispec.Image, error) {
+	_, cb, found := cs.Get(desc)
+	if !found {
+		rc, err := fetcher.Fetch(context.Background(), desc)
+		if err != nil {
+			return ocispec.Image{}, err
+		}
+		defer rc.Close()
+		if cb, err = io.ReadAll(io.LimitReader(rc, desc.Size)); err != nil {
+			return ocispec.Image{}, err
+		}
+		if digest.FromBytes(cb) != desc.Digest {
+			return ocispec.Image{}, fmt.Errorf("config content does not match digest %s", desc.Digest.String())
+		}
+	}
+	var conf ocispec.Image
+	if err := json.Unmarshal(cb, &conf); err != nil {
+		return ocispec.Image{}, err
+	}
+	return conf, nil
+}
+
+// configDetails returns the label and value of each image config detail shown in verbose
+// mode; settings with multiple values (env, labels, history) are listed one per line
+func configDetails(conf ocispec.Image) [][2]string {
+	var details [][2]string
+	add := func(label, value string) {
+		if value != "" {
+			details = append(details, [2]string{label, value})
+		}
+	}
+	if conf.Created != nil {
+		add("Created", conf.Created.Format(time.RFC3339))
+	}
+	if len(conf.Config.Entrypoint) > 0 {
+		b, _ := json.Marshal(conf.Config.Entrypoint)
+		add("Entrypoint", string(b))
+	}
+	if len(conf.Config.Cmd) > 0 {
+		b, _ := json.Marshal(conf.Config.Cmd)
+		add("Cmd", string(b))
+	}
+	for _, env := range conf.Config.Env {
+		add("Env", env)
+	}
+	var ports []string
+	for port := range conf.Config.ExposedPorts {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	add("Ports", strings.Join(ports, ", "))
+	add("User", conf.Config.User)
+	add("WorkingDir", conf.Config.WorkingDir)
+	var labels []string
+	for k, v := range conf.Config.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		add("Label", label)
+	}
+	for _, h := range conf.History {
+		step := h.CreatedBy
+		if h.EmptyLayer {
+			step += " (empty layer)"
+		}
+		if h.Created != nil {
+			step = h.Created.Format(time.RFC3339) + " " + step
+		}
+		add("History", step)
+	}
+	return details
+}
+
+// layersSize returns the total compressed size of the layers of an image manifest
+func layersSize(man ocispec.Manifest) int64 {
+	var size int64
+	for _, layer := range man.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// indexSizes summarizes the compressed layer sizes of the images in a manifest list/index.
+// Total counts each distinct layer once; a layer is shared when more than one platform's
+// image uses it, and unique otherwise.
+type indexSizes struct {
+	Platforms []platformSize `json:"platforms"`
+	Total     int64          `json:"total"`
+	Shared    int64          `json:"shared"`
+	Unique    int64          `json:"unique"`
+}
+
+type platformSize struct {
+	Digest   string `json:"digest"`
+	Platform string `json:"platform"`
+	Size     int64  `json:"size"`
+}
+
+// indexSizeSummary computes the layer size summary of the images (not attestations) of an index
+func indexSizeSummary(cs *store.MemoryStore, index ocispec.Index) indexSizes {
+	var (
+		sizes      indexSizes
+		layerSize  = map[digest.Digest]int64{}
+		layerUsers = map[digest.Digest]int{}
+	)
+	for _, desc := range index.Manifests {
+		if desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+			continue
+		}
+		switch desc.MediaType {
+		case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+		default:
+			continue
+		}
+		_, db, _ := cs.Get(desc)
+		var man ocispec.Manifest
+		if err := json.Unmarshal(db, &man); err != nil {
+			continue
+		}
+		platform := ""
+		if desc.Platform != nil {
+			platform = platforms.Format(*desc.Platform)
+		}
+		sizes.Platforms = append(sizes.Platforms, platformSize{
+			Digest:   desc.Digest.String(),
+			Platform: platform,
+			Size:     layersSize(man),
+		})
+		seen := map[digest.Digest]bool{}
+		for _, layer := range man.Layers {
+			if seen[layer.Digest] {
+				continue
+			}
+			seen[layer.Digest] = true
+			layerSize[layer.Digest] = layer.Size
+			layerUsers[layer.Digest]++
+		}
+	}
+	for dgst, size := range layerSize {
+		sizes.Total += size
+		if layerUsers[dgst] > 1 {
+			sizes.Shared += size
+		} else {
+			sizes.Unique += size
+		}
+	}
+	return sizes
+}
+
+// selectPlatform returns the descriptor of the image manifest matching the requested
+// platform, as a container runtime would select it from a manifest list/index
+func selectPlatform(cs *store.MemoryStore, descriptor ocispec.Descriptor, platformSpec string) (ocispec.Descriptor, error) {
+	platform, err := util.ParsePlatform(platformSpec)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	_, db, _ := cs.Get(descriptor)
+	switch descriptor.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		var idx ocispec.Index
+		if err := json.Unmarshal(db, &idx); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		desc, ok := util.MatchPlatform(platform, idx.Manifests)
+		if !ok {
+			return ocispec.Descriptor{}, fmt.Errorf("manifest list/index %s has no image for platform %s", descriptor.Digest.String(), platformSpec)
+		}
+		return desc, nil
+	case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+		// a single image manifest is either for the requested platform or not at all
+		var man ocispec.Manifest
+		if err := json.Unmarshal(db, &man); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		_, cb, _ := cs.Get(man.Config)
+		var conf ocispec.Image
+		if err := json.Unmarshal(cb, &conf); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		desc := descriptor
+		desc.Platform = &conf.Platform
+		if _, ok := util.MatchPlatform(platform, []ocispec.Descriptor{desc}); !ok {
+			return ocispec.Descriptor{}, fmt.Errorf("image %s is not available for platform %s", descriptor.Digest.String(), platformSpec)
+		}
+		return descriptor, nil
+	default:
+		return ocispec.Descriptor{}, fmt.Errorf("unknown descriptor type: %s", descriptor.MediaType)
 	}
 }
 
@@ -193,15 +492,17 @@ type indexJson struct {
 	MediaType     string             `json:"mediaType,omitempty"`
 	Manifests     []ocispec.Manifest `json:"manifests"`
 	Annotations   map[string]string  `json:"annotations,omitempty"`
+	Sizes         indexSizes         `json:"sizes"`
 }
 
 // struct for modeling a manifest as raw JSON output in a format that
 // includes the same content displayed in human-readable format
 type manifestJson struct {
-	Name   string `json:"name"`
-	Digest string `json:"digest"`
-	Os     string `json:"os,omitempty"`
-	Arch   string `json:"architecture,omitempty"`
+	Name       string `json:"name"`
+	Digest     string `json:"digest"`
+	Os         string `json:"os,omitempty"`
+	Arch       string `json:"architecture,omitempty"`
+	LayersSize int64  `json:"layersSize"`
 	ocispec.Manifest
 }
 
@@ -211,6 +512,7 @@ type manifestConfigJson struct {
 	Digest        string               `json:"digest"`
 	Os            string               `json:"os,omitempty"`
 	Arch          string               `json:"architecture,omitempty"`
+	LayersSize    int64                `json:"layersSize"`
 	MediaType     string               `json:"mediaType,omitempty"`
 	Config        ocispec.Image        `json:"config"`
 	Layers        []ocispec.Descriptor `json:"layers"`
@@ -234,6 +536,7 @@ func generateRawJSON(name string, descriptor ocispec.Descriptor, expandConfig bo
 			SchemaVersion: idx.SchemaVersion,
 			MediaType:     idx.MediaType,
 			Annotations:   idx.Annotations,
+			Sizes:         indexSizeSummary(ms, idx),
 		}
 		for _, m := range idx.Manifests {
 			_, man, _ := ms.Get(m)
@@ -266,11 +569,12 @@ func generateRawJSON(name string, descriptor ocispec.Descriptor, expandConfig bo
 		var rawJSON interface{}
 		if !expandConfig {
 			rawJSON = manifestJson{
-				Name:     name,
-				Digest:   descriptor.Digest.String(),
-				Os:       conf.OS,
-				Arch:     conf.Architecture,
-				Manifest: man,
+				Name:       name,
+				Digest:     descriptor.Digest.String(),
+				Os:         conf.OS,
+				Arch:       conf.Architecture,
+				LayersSize: layersSize(man),
+				Manifest:   man,
 			}
 		} else {
 			rawJSON = manifestConfigJson{
@@ -278,6 +582,7 @@ func generateRawJSON(name string, descriptor ocispec.Descriptor, expandConfig bo
 				Digest:        descriptor.Digest.String(),
 				Os:            conf.OS,
 				Arch:          conf.Architecture,
+				LayersSize:    layersSize(man),
 				Config:        conf,
 				Layers:        man.Layers,
 				SchemaVersion: man.SchemaVersion,
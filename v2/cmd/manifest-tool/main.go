@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
 	"github.com/estesp/manifest-tool/v2/pkg/util"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -59,6 +60,80 @@ func runApplication() error {
 			Value: util.ConfigDir(),
 			Usage: "either a directory path containing a Docker-formatted config.json or a specific JSON file formatted for registry auth",
 		},
+		&cli.StringFlag{
+			Name:  "ca-cert",
+			Usage: "PEM file of additional CA certificates to trust for registry communication",
+		},
+		&cli.StringFlag{
+			Name:  "client-cert",
+			Usage: "PEM client certificate presented to the target registry for mutual TLS (used with --client-key); not sent to source registries or mirrors",
+		},
+		&cli.StringFlag{
+			Name:  "client-key",
+			Usage: "PEM private key of the client certificate",
+		},
+		&cli.StringSliceFlag{
+			Name:  "certs-dir",
+			Value: cli.NewStringSlice(util.DefaultCertsDirs...),
+			Usage: "directory with per-registry certificates in <host[:port]>/ subdirectories (ca.crt, client.cert, client.key), as used by Docker and containerd",
+		},
+		&cli.StringFlag{
+			Name:  "hosts-dir",
+			Usage: "containerd hosts directory with a <host[:port]>/hosts.toml registry mirror and endpoint configuration per registry",
+		},
+		&cli.StringFlag{
+			Name:  "registries-conf",
+			Usage: "containers registries.conf file with registry mirror and endpoint configuration (version 2 format)",
+		},
+		&cli.DurationFlag{
+			Name:  "dial-timeout",
+			Value: util.DefaultTransportOptions.DialTimeout,
+			Usage: "timeout for establishing registry connections (0 for none)",
+		},
+		&cli.DurationFlag{
+			Name:  "tls-handshake-timeout",
+			Value: util.DefaultTransportOptions.TLSHandshakeTimeout,
+			Usage: "timeout for the TLS handshake with a registry (0 for none)",
+		},
+		&cli.DurationFlag{
+			Name:  "response-header-timeout",
+			Value: util.DefaultTransportOptions.ResponseHeaderTimeout,
+			Usage: "timeout for a registry to start responding after a request was sent (0 for none)",
+		},
+		&cli.DurationFlag{
+			Name:  "idle-conn-timeout",
+			Value: util.DefaultTransportOptions.IdleConnTimeout,
+			Usage: "time an idle registry connection is kept open for reuse (0 for no limit)",
+		},
+		&cli.IntFlag{
+			Name:  "max-idle-conns-per-host",
+			Value: util.DefaultTransportOptions.MaxIdleConnsPerHost,
+			Usage: "maximum number of idle connections kept open for reuse per registry",
+		},
+		&cli.BoolFlag{
+			Name:  "disable-http2",
+			Usage: "only use HTTP/1.1 for registry communication",
+		},
+		&cli.IntFlag{
+			Name:  "max-retries",
+			Value: util.DefaultTransportOptions.MaxRetries,
+			Usage: "number of times a registry request failing with a 429 or 5xx response or a connection reset is retried (0 for none)",
+		},
+		&cli.DurationFlag{
+			Name:  "retry-backoff",
+			Value: util.DefaultTransportOptions.RetryBackoff,
+			Usage: "initial wait before retrying a failed registry request, doubled on each retry",
+		},
+		&cli.DurationFlag{
+			Name:  "retry-max-backoff",
+			Value: util.DefaultTransportOptions.RetryMaxBackoff,
+			Usage: "maximum wait before retrying a failed registry request, including waits requested with Retry-After",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Value: registry.DefaultConcurrency,
+			Usage: "number of member images retrieved, and of component references pushed, in parallel",
+		},
 	}
 	app.Before = func(c *cli.Context) error {
 		if c.Bool("debug") {
@@ -66,6 +141,39 @@ func runApplication() error {
 		} else {
 			logrus.SetLevel(logrus.WarnLevel)
 		}
+		err := util.SetTLSOptions(util.TLSOptions{
+			CACert:     c.String("ca-cert"),
+			ClientCert: c.String("client-cert"),
+			ClientKey:  c.String("client-key"),
+			CertsDirs:  c.StringSlice("certs-dir"),
+		})
+		if err != nil {
+			return err
+		}
+		err = util.SetMirrorOptions(util.MirrorOptions{
+			HostsDir:       c.String("hosts-dir"),
+			RegistriesConf: c.String("registries-conf"),
+		})
+		if err != nil {
+			return err
+		}
+		err = util.SetTransportOptions(util.TransportOptions{
+			DialTimeout:           c.Duration("dial-timeout"),
+			TLSHandshakeTimeout:   c.Duration("tls-handshake-timeout"),
+			ResponseHeaderTimeout: c.Duration("response-header-timeout"),
+			IdleConnTimeout:       c.Duration("idle-conn-timeout"),
+			MaxIdleConnsPerHost:   c.Int("max-idle-conns-per-host"),
+			DisableHTTP2:          c.Bool("disable-http2"),
+			MaxRetries:            c.Int("max-retries"),
+			RetryBackoff:          c.Duration("retry-backoff"),
+			RetryMaxBackoff:       c.Duration("retry-max-backoff"),
+		})
+		if err != nil {
+			return err
+		}
+		if err := registry.SetConcurrency(c.Int("concurrency")); err != nil {
+			return err
+		}
 		dockerAuthPath := c.String("docker-cfg")
 		// if set to the default, we don't check for validity because it may not
 		// even exist
@@ -88,10 +196,15 @@ func runApplication() error {
 		}
 		return nil
 	}
-	// currently support inspect and pushml
 	app.Commands = []*cli.Command{
 		inspectCmd,
 		pushCmd,
+		copyCmd,
+		amendCmd,
+		convertCmd,
+		referrersCmd,
+		attachCmd,
+		diffCmd,
 	}
 
 	return app.Run(os.Args)
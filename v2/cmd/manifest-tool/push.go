@@ -1,13 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/layout"
 	"github.com/estesp/manifest-tool/v2/pkg/registry"
 	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
 
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
@@ -15,6 +20,35 @@ import (
 	yaml "gopkg.in/yaml.v3"
 )
 
+var (
+	ociLayoutFlag = &cli.StringFlag{
+		Name:  "oci-layout",
+		Usage: "write the manifest list/index to an OCI image layout directory (or tar archive if the path ends in .tar) instead of pushing it to the registry",
+	}
+	includeLayersFlag = &cli.BoolFlag{
+		Name:  "include-layers",
+		Usage: "also copy the layer blobs of all member images into the OCI image layout",
+	}
+	copyReferrersFlag = &cli.BoolFlag{
+		Name:  "copy-referrers",
+		Usage: "also copy the referrers (signatures, SBOMs and other artifacts) of images copied from other repositories",
+	}
+	attestationsFlag = &cli.StringFlag{
+		Name:  "attestations",
+		Value: "keep",
+		Usage: "attestation manifests of member images to include: keep, drop, or a comma-separated list of in-toto predicate type URIs to keep",
+	}
+	dryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "resolve all member images and print the manifest list/index that would be pushed without pushing anything",
+	}
+	outputFlag = &cli.StringFlag{
+		Name:  "output",
+		Value: "text",
+		Usage: "output format of the push result: text or json",
+	}
+)
+
 var pushCmd = &cli.Command{
 	Name:  "push",
 	Usage: "push a manifest list/OCI index entry to a registry with provided image details",
@@ -34,6 +68,12 @@ var pushCmd = &cli.Command{
 					Name:  "ignore-missing",
 					Usage: "only warn on missing images defined in YAML spec",
 				},
+				ociLayoutFlag,
+				includeLayersFlag,
+				dryRunFlag,
+				copyReferrersFlag,
+				attestationsFlag,
+				outputFlag,
 			},
 			Action: func(c *cli.Context) error {
 				filePath := c.Args().First()
@@ -52,16 +92,7 @@ var pushCmd = &cli.Command{
 					logrus.Fatalf(fmt.Sprintf("Can't unmarshal YAML file %q: %v", filePath, err))
 				}
 
-				manifestType := types.Docker
-				if c.String("type") == "oci" {
-					manifestType = types.OCI
-				}
-				digest, length, err := registry.PushManifestList(c.String("username"), c.String("password"), yamlInput, c.Bool("ignore-missing"), c.Bool("insecure"), c.Bool("plain-http"), manifestType, c.String("docker-cfg"))
-				if err != nil {
-					logrus.Fatal(err)
-				}
-				fmt.Printf("Digest: %s %d\n", digest, length)
-
+				pushManifestList(c, yamlInput)
 				return nil
 			},
 		},
@@ -92,6 +123,20 @@ var pushCmd = &cli.Command{
 					Name:  "ignore-missing",
 					Usage: "only warn on missing images defined in platform list",
 				},
+				&cli.StringSliceFlag{
+					Name:  "annotation",
+					Usage: "annotation to set on each manifest entry of the manifest list/index, as key=value (can be repeated)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "index-annotation",
+					Usage: "annotation to set on the manifest list/index itself, as key=value (can be repeated; OCI index type only)",
+				},
+				ociLayoutFlag,
+				includeLayersFlag,
+				dryRunFlag,
+				copyReferrersFlag,
+				attestationsFlag,
+				outputFlag,
 			},
 			Action: func(c *cli.Context) error {
 				platforms := c.StringSlice("platforms")
@@ -99,6 +144,7 @@ var pushCmd = &cli.Command{
 				target := c.String("target")
 				tags := c.StringSlice("tags")
 				srcImages := []types.ManifestEntry{}
+				annotations := parseAnnotations(c.StringSlice("annotation"))
 
 				for _, platform := range platforms {
 					osArchArr := strings.Split(platform, "/")
@@ -117,25 +163,274 @@ var pushCmd = &cli.Command{
 							Architecture: arch,
 							Variant:      variant,
 						},
+						Annotations: annotations,
 					})
 				}
 				yamlInput := types.YAMLInput{
-					Image:     target,
-					Tags:      tags,
-					Manifests: srcImages,
+					Image:       target,
+					Tags:        tags,
+					Annotations: parseAnnotations(c.StringSlice("index-annotation")),
+					Manifests:   srcImages,
 				}
-				manifestType := types.Docker
-				if c.String("type") == "oci" {
-					manifestType = types.OCI
-				}
-				digest, length, err := registry.PushManifestList(c.String("username"), c.String("password"), yamlInput, c.Bool("ignore-missing"), c.Bool("insecure"), c.Bool("plain-http"), manifestType, c.String("docker-cfg"))
-				if err != nil {
-					logrus.Fatal(err)
-				}
-				fmt.Printf("Digest: %s %d\n", digest, length)
-
+				pushManifestList(c, yamlInput)
 				return nil
 			},
 		},
 	},
 }
+
+// pushManifestList assembles the manifest list/index described by the input and either
+// pushes it to the target registry or writes it to an OCI image layout
+func pushManifestList(c *cli.Context, input types.YAMLInput) {
+	manifestType := types.Docker
+	if c.String("type") == "oci" {
+		manifestType = types.OCI
+	}
+	if c.Bool("include-layers") && c.String("oci-layout") == "" {
+		logrus.Fatal("the --include-layers flag is only valid when used with --oci-layout")
+	}
+	if c.Bool("dry-run") && c.String("oci-layout") != "" {
+		logrus.Fatal("the --dry-run flag cannot be combined with --oci-layout")
+	}
+	if c.Bool("copy-referrers") && c.String("oci-layout") != "" {
+		logrus.Fatal("the --copy-referrers flag cannot be combined with --oci-layout")
+	}
+	jsonOutput := false
+	switch c.String("output") {
+	case "text":
+	case "json":
+		jsonOutput = true
+	default:
+		logrus.Fatalf("unsupported output format %q: must be text or json", c.String("output"))
+	}
+	attestationFilter, err := parseAttestationFilter(c.String("attestations"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	manifestList, memoryStore, err := registry.AssembleManifestList(c.String("username"), c.String("password"), input, c.Bool("ignore-missing"), c.Bool("insecure"), c.Bool("plain-http"), manifestType, attestationFilter, c.String("docker-cfg"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if c.Bool("dry-run") {
+		desc, indexJSON, pushRefs, err := registry.DryRun(manifestList)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if jsonOutput {
+			printJSON(newDryRunResult(manifestList, desc, pushRefs, pushTags(manifestList, input.Tags)))
+			return
+		}
+		fmt.Printf("%s\n", indexJSON)
+		fmt.Printf("Digest: %s %d\n", desc.Digest, desc.Size)
+		fmt.Printf("Type: %s\n", desc.MediaType)
+		fmt.Printf("Tags: %s\n", strings.Join(pushTags(manifestList, input.Tags), ", "))
+		if len(pushRefs) > 0 {
+			fmt.Println("Component references to push:")
+			for _, ref := range pushRefs {
+				fmt.Printf("  %s\n", ref)
+			}
+		}
+		return
+	}
+
+	if layoutPath := c.String("oci-layout"); layoutPath != "" {
+		digest, length, err := registry.WriteLayout(manifestList, input.Tags, memoryStore, layoutPath, c.Bool("include-layers"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if jsonOutput {
+			printJSON(newLayoutResult(manifestList, digest, length, layoutPath, pushTags(manifestList, input.Tags)))
+			return
+		}
+		fmt.Printf("Digest: %s %d\n", digest, length)
+		return
+	}
+
+	digest, length, err := registry.Push(manifestList, input.Tags, memoryStore)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	var referrers int
+	if c.Bool("copy-referrers") {
+		referrers, err = registry.PushReferrers(manifestList, memoryStore)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("copied %d referrers to %s", referrers, manifestList.Reference.Name())
+	}
+	if jsonOutput {
+		result := newPushResult(manifestList, digest, length, pushTags(manifestList, input.Tags))
+		for i, transfer := range registry.Transfers(manifestList, memoryStore) {
+			result.Entries[i].Transfer = transfer
+		}
+		result.Referrers = referrers
+		printJSON(result)
+		return
+	}
+	fmt.Printf("Digest: %s %d\n", digest, length)
+}
+
+// pushResult is the JSON output of a manifest list/index push. Tags are the registry tags
+// pushed (or, with DryRun, to be pushed) and PushRefs the component manifest references a
+// dry run would copy to the target repository. When written to an OCI image layout, Layout
+// is the layout path and References the image references the index can be read back with.
+type pushResult struct {
+	Digest     string            `json:"digest"`
+	Size       int               `json:"size"`
+	MediaType  string            `json:"mediaType"`
+	Tags       []string          `json:"tags,omitempty"`
+	Layout     string            `json:"layout,omitempty"`
+	References []string          `json:"references,omitempty"`
+	DryRun     bool              `json:"dryRun,omitempty"`
+	PushRefs   []string          `json:"pushRefs,omitempty"`
+	Referrers  int               `json:"referrers,omitempty"`
+	Entries    []pushResultEntry `json:"entries"`
+	RateLimits []util.RateLimit  `json:"rateLimits,omitempty"`
+}
+
+// pushResultEntry describes one member entry of a pushed manifest list/index. Source is the
+// registry or OCI image layout reference the manifest was read from. Copied is set when the
+// manifest was (or, in a dry run, would be) copied into the target repository, and Transfer
+// tells, after a push, whether its blobs were copied, mounted or already existing there.
+// Skipped is set when the image of the entry was missing and ignored.
+type pushResultEntry struct {
+	Source      string            `json:"source,omitempty"`
+	Digest      string            `json:"digest,omitempty"`
+	MediaType   string            `json:"mediaType,omitempty"`
+	Platform    *ocispec.Platform `json:"platform,omitempty"`
+	Attestation bool              `json:"attestation,omitempty"`
+	Copied      bool              `json:"copied"`
+	Transfer    string            `json:"transfer,omitempty"`
+	Skipped     bool              `json:"skipped,omitempty"`
+}
+
+// newPushResult returns the push result for the manifest list/index with the given digest and size
+func newPushResult(m types.ManifestList, digest string, size int, tags []string) pushResult {
+	result := pushResult{
+		Digest:     digest,
+		Size:       size,
+		MediaType:  types.MediaTypeDockerSchema2ManifestList,
+		Tags:       tags,
+		Entries:    []pushResultEntry{},
+		RateLimits: util.RateLimits(),
+	}
+	if m.Type == types.OCI {
+		result.MediaType = ocispec.MediaTypeImageIndex
+	}
+	for _, man := range m.Manifests {
+		entry := pushResultEntry{
+			Digest:      man.Descriptor.Digest.String(),
+			MediaType:   man.Descriptor.MediaType,
+			Attestation: man.Descriptor.Annotations["vnd.docker.reference.type"] == "attestation-manifest",
+			Copied:      man.PushRef,
+		}
+		if man.Source != nil {
+			entry.Source = man.Source.String()
+		} else {
+			entry.Source = man.Layout
+		}
+		if !entry.Attestation {
+			entry.Platform = man.Descriptor.Platform
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	for _, img := range m.Skipped {
+		entry := pushResultEntry{
+			Source:  img.Image,
+			Skipped: true,
+		}
+		if img.Platform.OS != "" || img.Platform.Architecture != "" {
+			platform := img.Platform
+			entry.Platform = &platform
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	return result
+}
+
+// newDryRunResult returns the result of a dry run for the manifest list/index descriptor,
+// listing the component references that would be copied to the target repository
+func newDryRunResult(m types.ManifestList, desc ocispec.Descriptor, pushRefs, tags []string) pushResult {
+	result := newPushResult(m, desc.Digest.String(), int(desc.Size), tags)
+	result.DryRun = true
+	result.PushRefs = pushRefs
+	return result
+}
+
+// newLayoutResult returns the result for the manifest list/index with the given digest and
+// size written to the OCI image layout at layoutPath under the given reference names; no
+// registry content is pushed, so no tags are reported and no entries are marked copied
+func newLayoutResult(m types.ManifestList, digest string, size int, layoutPath string, names []string) pushResult {
+	result := newPushResult(m, digest, size, nil)
+	result.Layout = layoutPath
+	scheme := layout.LayoutScheme
+	if layout.IsArchive(layoutPath) {
+		scheme = layout.ArchiveScheme
+	}
+	if len(names) == 0 {
+		result.References = []string{scheme + layoutPath}
+	}
+	for _, name := range names {
+		result.References = append(result.References, scheme+layoutPath+":"+name)
+	}
+	for i := range result.Entries {
+		result.Entries[i].Copied = false
+	}
+	return result
+}
+
+// printJSON prints the value as indented JSON
+func printJSON(v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	fmt.Println(string(out))
+}
+
+// parseAttestationFilter parses the --attestations value: keep, drop, or a comma-separated
+// list of in-toto predicate types, each of which must be an absolute URI
+func parseAttestationFilter(value string) (types.AttestationFilter, error) {
+	var filter types.AttestationFilter
+	switch value {
+	case "keep":
+		return filter, nil
+	case "drop":
+		filter.Drop = true
+		return filter, nil
+	}
+	for _, predicateType := range strings.Split(value, ",") {
+		predicateType = strings.TrimSpace(predicateType)
+		if u, err := url.Parse(predicateType); err != nil || !u.IsAbs() {
+			return types.AttestationFilter{}, fmt.Errorf("invalid --attestations value %q: must be keep, drop, or a comma-separated list of in-toto predicate type URIs", value)
+		}
+		filter.PredicateTypes = append(filter.PredicateTypes, predicateType)
+	}
+	return filter, nil
+}
+
+// parseAnnotations converts a list of key=value strings into an annotations map
+func parseAnnotations(values []string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	annotations := map[string]string{}
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			logrus.Fatalf("annotation %q must be of the form key=value", value)
+		}
+		annotations[key] = val
+	}
+	return annotations
+}
+
+// pushTags returns the tag of the target reference along with any additional tags
+func pushTags(m types.ManifestList, addedTags []string) []string {
+	var tags []string
+	if tagged, ok := m.Reference.(reference.Tagged); ok {
+		tags = append(tags, tagged.Tag())
+	}
+	return append(tags, addedTags...)
+}
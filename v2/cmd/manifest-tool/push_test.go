@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testManifestList returns a manifest list with one member copied from another repository,
+// one already in the target repository, an attestation and a skipped image
+func testManifestList(t *testing.T) types.ManifestList {
+	parse := func(name string) reference.Named {
+		ref, err := reference.ParseNormalizedNamed(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ref
+	}
+	return types.ManifestList{
+		Type:      types.OCI,
+		Reference: parse("myregistry.io/app:v1"),
+		Manifests: []types.Manifest{
+			{
+				Descriptor: ocispec.Descriptor{
+					MediaType: ocispec.MediaTypeImageManifest,
+					Digest:    digest.FromString("amd64"),
+					Size:      100,
+					Platform:  &ocispec.Platform{OS: "linux", Architecture: "amd64"},
+				},
+				PushRef: true,
+				Source:  parse("myregistry.io/app-amd64:v1"),
+			},
+			{
+				Descriptor: ocispec.Descriptor{
+					MediaType: ocispec.MediaTypeImageManifest,
+					Digest:    digest.FromString("arm64"),
+					Size:      100,
+					Platform:  &ocispec.Platform{OS: "linux", Architecture: "arm64"},
+				},
+				Source: parse("myregistry.io/app:v1-arm64"),
+			},
+			{
+				Descriptor: ocispec.Descriptor{
+					MediaType: ocispec.MediaTypeImageManifest,
+					Digest:    digest.FromString("attestation"),
+					Size:      100,
+					Platform:  &ocispec.Platform{OS: "unknown", Architecture: "unknown"},
+					Annotations: map[string]string{
+						"vnd.docker.reference.type":   "attestation-manifest",
+						"vnd.docker.reference.digest": digest.FromString("amd64").String(),
+					},
+				},
+				PushRef: true,
+				Source:  parse("myregistry.io/app-amd64:v1"),
+			},
+		},
+		Skipped: []types.ManifestEntry{
+			{Image: "myregistry.io/app-s390x:v1", Platform: ocispec.Platform{OS: "linux", Architecture: "s390x"}},
+		},
+	}
+}
+
+// jsonResult is the decoded JSON output of a push
+type jsonResult struct {
+	Digest     string   `json:"digest"`
+	MediaType  string   `json:"mediaType"`
+	Tags       []string `json:"tags"`
+	Layout     string   `json:"layout"`
+	References []string `json:"references"`
+	DryRun     bool     `json:"dryRun"`
+	PushRefs   []string `json:"pushRefs"`
+	Entries    []struct {
+		Source      string            `json:"source"`
+		Digest      string            `json:"digest"`
+		Platform    *ocispec.Platform `json:"platform"`
+		Attestation bool              `json:"attestation"`
+		Copied      *bool             `json:"copied"`
+		Transfer    string            `json:"transfer"`
+		Skipped     bool              `json:"skipped"`
+	} `json:"entries"`
+}
+
+func decodeResult(t *testing.T, result pushResult) (jsonResult, map[string]interface{}) {
+	b, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded jsonResult
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var keys map[string]interface{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		t.Fatal(err)
+	}
+	return decoded, keys
+}
+
+func TestPushResultJSON(t *testing.T) {
+	m := testManifestList(t)
+	desc, _, pushRefs, err := registry.DryRun(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := pushTags(m, []string{"latest"})
+	amd64Ref := "myregistry.io/app@" + digest.FromString("amd64").String()
+	attestationRef := "myregistry.io/app@" + digest.FromString("attestation").String()
+
+	var tests = []struct {
+		name       string
+		result     pushResult
+		tags       []string
+		layout     string
+		references []string
+		dryRun     bool
+		pushRefs   []string
+		copied     []bool
+	}{
+		{
+			name:   "push",
+			result: newPushResult(m, desc.Digest.String(), int(desc.Size), tags),
+			tags:   []string{"v1", "latest"},
+			copied: []bool{true, false, true},
+		},
+		{
+			name:     "dry run",
+			result:   newDryRunResult(m, desc, pushRefs, tags),
+			tags:     []string{"v1", "latest"},
+			dryRun:   true,
+			pushRefs: []string{amd64Ref, attestationRef},
+			copied:   []bool{true, false, true},
+		},
+		{
+			name:       "layout",
+			result:     newLayoutResult(m, desc.Digest.String(), int(desc.Size), "release", tags),
+			layout:     "release",
+			references: []string{"oci-layout://release:v1", "oci-layout://release:latest"},
+			copied:     []bool{false, false, false},
+		},
+		{
+			name:       "layout archive",
+			result:     newLayoutResult(m, desc.Digest.String(), int(desc.Size), "release.tar", tags),
+			layout:     "release.tar",
+			references: []string{"oci-archive://release.tar:v1", "oci-archive://release.tar:latest"},
+			copied:     []bool{false, false, false},
+		},
+		{
+			name:       "untagged layout",
+			result:     newLayoutResult(m, desc.Digest.String(), int(desc.Size), "release", nil),
+			layout:     "release",
+			references: []string{"oci-layout://release"},
+			copied:     []bool{false, false, false},
+		},
+	}
+	for _, test := range tests {
+		result, keys := decodeResult(t, test.result)
+		if result.Digest != desc.Digest.String() || result.MediaType != ocispec.MediaTypeImageIndex {
+			t.Errorf("%s: unexpected digest %s and media type %s", test.name, result.Digest, result.MediaType)
+		}
+		if !reflect.DeepEqual(result.Tags, test.tags) {
+			t.Errorf("%s: expected tags %v, got %v", test.name, test.tags, result.Tags)
+		}
+		if _, ok := keys["tags"]; ok != (test.tags != nil) {
+			t.Errorf("%s: unexpected presence of tags in %v", test.name, keys)
+		}
+		if result.Layout != test.layout || !reflect.DeepEqual(result.References, test.references) {
+			t.Errorf("%s: expected layout %q with references %v, got %q with %v", test.name, test.layout, test.references, result.Layout, result.References)
+		}
+		if result.DryRun != test.dryRun || !reflect.DeepEqual(result.PushRefs, test.pushRefs) {
+			t.Errorf("%s: expected dry run %v with references %v, got %v with %v", test.name, test.dryRun, test.pushRefs, result.DryRun, result.PushRefs)
+		}
+
+		if len(result.Entries) != len(m.Manifests)+len(m.Skipped) {
+			t.Fatalf("%s: expected %d entries, got %d", test.name, len(m.Manifests)+len(m.Skipped), len(result.Entries))
+		}
+		for i, entry := range result.Entries[:len(m.Manifests)] {
+			man := m.Manifests[i]
+			if entry.Digest != man.Descriptor.Digest.String() || entry.Source != man.Source.String() {
+				t.Errorf("%s: unexpected entry %d: %+v", test.name, i, entry)
+			}
+			if entry.Copied == nil || *entry.Copied != test.copied[i] {
+				t.Errorf("%s: expected entry %d copied %v, got %v", test.name, i, test.copied[i], entry.Copied)
+			}
+			if entry.Transfer != "" {
+				t.Errorf("%s: expected no transfer for entry %d, got %s", test.name, i, entry.Transfer)
+			}
+		}
+		if entry := result.Entries[0]; entry.Platform == nil || entry.Platform.Architecture != "amd64" || entry.Attestation {
+			t.Errorf("%s: unexpected image entry: %+v", test.name, entry)
+		}
+		if entry := result.Entries[2]; entry.Platform != nil || !entry.Attestation {
+			t.Errorf("%s: expected an attestation entry without platform, got %+v", test.name, entry)
+		}
+		if entry := result.Entries[3]; !entry.Skipped || entry.Source != "myregistry.io/app-s390x:v1" || entry.Platform == nil || entry.Platform.Architecture != "s390x" {
+			t.Errorf("%s: unexpected skipped entry: %+v", test.name, entry)
+		}
+	}
+}
+
+func TestPushResultLayoutSource(t *testing.T) {
+	m := testManifestList(t)
+	m.Manifests[0].Source = nil
+	m.Manifests[0].Layout = "oci-layout://build:v1-amd64"
+	result, _ := decodeResult(t, newPushResult(m, digest.FromString("index").String(), 100, nil))
+	if result.Entries[0].Source != "oci-layout://build:v1-amd64" {
+		t.Errorf("expected the layout reference as source, got %q", result.Entries[0].Source)
+	}
+	if result.Entries[1].Source != "myregistry.io/app:v1-arm64" {
+		t.Errorf("expected the registry reference as source, got %q", result.Entries[1].Source)
+	}
+}
+
+func TestParseAttestationFilter(t *testing.T) {
+	var tests = []struct {
+		value  string
+		filter types.AttestationFilter
+		err    bool
+	}{
+		{value: "keep"},
+		{value: "drop", filter: types.AttestationFilter{Drop: true}},
+		{
+			value:  types.PredicateSLSAProvenanceV02,
+			filter: types.AttestationFilter{PredicateTypes: []string{types.PredicateSLSAProvenanceV02}},
+		},
+		{
+			value:  "https://slsa.dev/provenance/v0.2, https://spdx.dev/Document",
+			filter: types.AttestationFilter{PredicateTypes: []string{"https://slsa.dev/provenance/v0.2", "https://spdx.dev/Document"}},
+		},
+		{value: "dorp", err: true},
+		{value: "provenance", err: true},
+		{value: "https://spdx.dev/Document,sbom", err: true},
+		{value: "https://spdx.dev/Document,", err: true},
+		{value: "", err: true},
+	}
+	for _, test := range tests {
+		filter, err := parseAttestationFilter(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(filter, test.filter) {
+			t.Errorf("%q: expected %+v, got %+v", test.value, test.filter, filter)
+		}
+	}
+}
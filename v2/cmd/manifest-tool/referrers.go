@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var referrersCmd = &cli.Command{
+	Name:      "referrers",
+	Usage:     "list artifacts (signatures, SBOMs, attestations) attached to an image, or to each image of a manifest list/index, via the referrers API",
+	ArgsUsage: "NAME[:TAG|@DIGEST|:TAG@DIGEST]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "artifact-type",
+			Usage: "only list referrers with this artifact type",
+		},
+		&cli.BoolFlag{
+			Name:  "raw",
+			Usage: "raw JSON output",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		imageRef, err := util.ParseName(c.Args().First())
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		_, tagged := imageRef.(reference.NamedTagged)
+		_, digested := imageRef.(reference.Canonical)
+		if !tagged && !digested {
+			logrus.Fatal("image reference must include a tag or digest; manifest-tool does not default to 'latest'")
+		}
+		err = util.CreateRegistryHost(imageRef, c.String("username"), c.String("password"), c.Bool("insecure"),
+			c.Bool("plain-http"), c.String("docker-cfg"), false)
+		if err != nil {
+			return fmt.Errorf("error creating registry host configuration: %v", err)
+		}
+
+		resolver := util.GetResolver()
+		memoryStore := store.NewMemoryStore()
+		descriptor, err := registry.FetchDescriptor(resolver, memoryStore, imageRef)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		// the image itself, followed by the platform-specific images of a manifest list/index
+		subjects := []ocispec.Descriptor{descriptor}
+		switch descriptor.MediaType {
+		case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+			_, db, _ := memoryStore.Get(descriptor)
+			var index ocispec.Index
+			if err := json.Unmarshal(db, &index); err != nil {
+				logrus.Fatal(err)
+			}
+			for _, desc := range index.Manifests {
+				if desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+					continue
+				}
+				subjects = append(subjects, desc)
+			}
+		}
+
+		var results []referrersResult
+		for _, subject := range subjects {
+			referrers, err := registry.Referrers(resolver, memoryStore, imageRef, subject.Digest, c.String("artifact-type"))
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			results = append(results, referrersResult{
+				Subject:   subject.Digest.String(),
+				Platform:  subject.Platform,
+				Referrers: referrers,
+			})
+		}
+
+		if c.Bool("raw") {
+			out, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+		for _, result := range results {
+			subject := result.Subject
+			if result.Platform != nil {
+				subject = fmt.Sprintf("%s (%s)", subject, platforms.Format(*result.Platform))
+			}
+			fmt.Printf("Referrers for %s: %d\n", subject, len(result.Referrers))
+			for i, ref := range result.Referrers {
+				fmt.Printf("[%d]   Digest: %s\n", i+1, ref.Digest)
+				fmt.Printf("[%d]     Type: %s\n", i+1, ref.MediaType)
+				if ref.ArtifactType != "" {
+					fmt.Printf("[%d] Artifact: %s\n", i+1, ref.ArtifactType)
+				}
+				fmt.Printf("[%d]     Size: %d\n", i+1, ref.Size)
+				if created, ok := ref.Annotations[ocispec.AnnotationCreated]; ok {
+					fmt.Printf("[%d]  Created: %s\n", i+1, created)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// referrersResult holds the referrers of one image for raw JSON output
+type referrersResult struct {
+	Subject   string               `json:"subject"`
+	Platform  *ocispec.Platform    `json:"platform,omitempty"`
+	Referrers []ocispec.Descriptor `json:"referrers"`
+}
@@ -0,0 +1,210 @@
+package layout
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParseReference(t *testing.T) {
+	dgst := digest.FromString("index").String()
+	var tests = []struct {
+		name    string
+		path    string
+		archive bool
+		ref     string
+		err     bool
+	}{
+		{name: "oci-layout://layout", path: "layout"},
+		{name: "oci-layout:///tmp/layout:v1", path: "/tmp/layout", ref: "v1"},
+		{name: "oci-layout://./layout@" + dgst, path: "./layout", ref: dgst},
+		{name: "oci-layout://host:5000/layout", path: "host:5000/layout"},
+		{name: "oci-layout://host:5000/layout:v1", path: "host:5000/layout", ref: "v1"},
+		{name: `oci-layout://C:\layouts\app`, path: `C:\layouts\app`},
+		{name: "oci-archive://image.tar", path: "image.tar", archive: true},
+		{name: "oci-archive:///tmp/image.tar:latest", path: "/tmp/image.tar", archive: true, ref: "latest"},
+		{name: "oci-archive://image.tar@" + dgst, path: "image.tar", archive: true, ref: dgst},
+		{name: "oci-layout://layout@sha256:1234", err: true},
+		{name: "oci-layout://", err: true},
+		{name: "docker.io/library/alpine:latest", err: true},
+	}
+	for _, test := range tests {
+		path, archive, ref, err := ParseReference(test.name)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if path != test.path || archive != test.archive || ref != test.ref {
+			t.Errorf("%s: expected (%q, %v, %q), got (%q, %v, %q)", test.name, test.path, test.archive, test.ref, path, archive, ref)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	const (
+		manifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+		index    = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json"}`
+	)
+	manifestDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString(manifest),
+		Size:      int64(len(manifest)),
+	}
+	indexDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Digest:    digest.FromString(index),
+		Size:      int64(len(index)),
+	}
+	// a layer larger than a tar block, so that the entries following it are not block aligned
+	// with its start
+	layer := strings.Repeat("layer content ", 100)
+	layerDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayer,
+		Digest:    digest.FromString(layer),
+		Size:      int64(len(layer)),
+	}
+	blobs := map[digest.Digest]string{
+		manifestDesc.Digest: manifest,
+		indexDesc.Digest:    index,
+		layerDesc.Digest:    layer,
+	}
+
+	for _, archive := range []bool{false, true} {
+		root := filepath.Join(t.TempDir(), "layout")
+		if archive {
+			root += ".tar"
+		}
+		w, err := NewWriter(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, desc := range []ocispec.Descriptor{layerDesc, manifestDesc, indexDesc} {
+			if err := w.WriteBlob(desc, strings.NewReader(blobs[desc.Digest])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w.AddReference(indexDesc, "v1")
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewReader(root, archive)
+		if err != nil {
+			t.Fatalf("archive %v: %v", archive, err)
+		}
+		for _, ref := range []string{"", "v1", indexDesc.Digest.String()} {
+			desc, err := r.Resolve(ref)
+			if err != nil {
+				t.Errorf("archive %v: unable to resolve %q: %v", archive, ref, err)
+				continue
+			}
+			if desc.Digest != indexDesc.Digest || desc.MediaType != indexDesc.MediaType {
+				t.Errorf("archive %v: expected %s for %q, got %s", archive, indexDesc.Digest, ref, desc.Digest)
+			}
+		}
+		// manifests which are not part of the index are resolved from their content
+		desc, err := r.Resolve(manifestDesc.Digest.String())
+		if err != nil {
+			t.Errorf("archive %v: %v", archive, err)
+		} else if desc.MediaType != manifestDesc.MediaType || desc.Size != manifestDesc.Size {
+			t.Errorf("archive %v: expected %+v, got %+v", archive, manifestDesc, desc)
+		}
+		if _, err := r.Resolve("v2"); err == nil {
+			t.Errorf("archive %v: expected error resolving a missing tag", archive)
+		}
+
+		for dgst, content := range blobs {
+			rc, err := r.Fetch(context.Background(), ocispec.Descriptor{Digest: dgst})
+			if err != nil {
+				t.Errorf("archive %v: unable to fetch %s: %v", archive, dgst, err)
+				continue
+			}
+			b, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != content {
+				t.Errorf("archive %v: unexpected content for %s: %q", archive, dgst, b)
+			}
+		}
+		if _, err := r.Fetch(context.Background(), ocispec.Descriptor{Digest: digest.FromString("missing")}); err == nil {
+			t.Errorf("archive %v: expected error fetching a missing blob", archive)
+		}
+	}
+}
+
+// TestReadArchive reads an archive created by other tools, with "./" prefixed names, a
+// directory entry and extended headers before the blob content
+func TestReadArchive(t *testing.T) {
+	blob := "{}"
+	dgst := digest.FromString(blob)
+	index := `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` +
+		dgst.String() + `","size":2,"annotations":{"org.opencontainers.image.ref.name":"v1"}}]}`
+
+	root := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	entries := []struct {
+		hdr     tar.Header
+		content string
+	}{
+		{hdr: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "./index.json", Typeflag: tar.TypeReg, Mode: 0644}, content: index},
+		{hdr: tar.Header{
+			Name:       "./" + blobPath(dgst),
+			Typeflag:   tar.TypeReg,
+			Mode:       0644,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{"comment": strings.Repeat("x", 1000)},
+		}, content: blob},
+	}
+	for _, entry := range entries {
+		entry.hdr.Size = int64(len(entry.content))
+		if err := tw.WriteHeader(&entry.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := NewReader(root, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := r.Resolve("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != dgst {
+		t.Errorf("expected %s, got %s", dgst, desc.Digest)
+	}
+	b, err := r.readFile(blobPath(dgst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != blob {
+		t.Errorf("unexpected blob content %q", b)
+	}
+}
@@ -0,0 +1,239 @@
+package layout
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// BlobsDir is the directory within an OCI image layout which holds all blobs
+	BlobsDir = "blobs"
+	// IndexFile is the name of the top-level index of an OCI image layout
+	IndexFile = "index.json"
+)
+
+// Writer writes content to an OCI image layout, stored either as a directory or, when
+// the path ends in ".tar", as a tar archive of the layout
+type Writer struct {
+	root  string
+	file  *os.File
+	tw    *tar.Writer
+	blobs map[digest.Digest]bool
+	index ocispec.Index
+}
+
+// NewWriter creates a writer for an OCI image layout at the given path. An existing
+// layout directory is added to, keeping the entries of its index; a tar archive is
+// always created from scratch.
+func NewWriter(path string) (*Writer, error) {
+	w := &Writer{
+		root:  path,
+		blobs: map[digest.Digest]bool{},
+		index: ocispec.Index{
+			Versioned: specs.Versioned{
+				SchemaVersion: 2,
+			},
+			MediaType: ocispec.MediaTypeImageIndex,
+		},
+	}
+	if IsArchive(path) {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create OCI layout archive %s: %w", path, err)
+		}
+		w.file = f
+		w.tw = tar.NewWriter(f)
+	} else {
+		if err := os.MkdirAll(filepath.Join(path, BlobsDir), 0755); err != nil {
+			return nil, fmt.Errorf("unable to create OCI layout directory %s: %w", path, err)
+		}
+		ib, err := os.ReadFile(filepath.Join(path, IndexFile))
+		if err == nil {
+			if err := json.Unmarshal(ib, &w.index); err != nil {
+				return nil, fmt.Errorf("unable to parse existing OCI layout index in %s: %w", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	layout, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	if err := w.writeFile(ocispec.ImageLayoutFile, layout); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// IsArchive returns true if the layout path refers to a tar archive of an OCI image layout
+func IsArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar")
+}
+
+// WriteBlob writes the content for a descriptor into the blobs directory of the layout;
+// blobs which are already part of the layout are skipped. Content is verified against
+// the descriptor's size and digest before it becomes part of the layout.
+func (w *Writer) WriteBlob(desc ocispec.Descriptor, r io.Reader) error {
+	if w.blobs[desc.Digest] {
+		return nil
+	}
+	if err := desc.Digest.Validate(); err != nil {
+		return err
+	}
+	blobPath := filepath.Join(BlobsDir, desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+
+	var err error
+	if w.tw != nil {
+		err = w.writeArchiveBlob(blobPath, desc, r)
+	} else {
+		err = w.writeDirBlob(blobPath, desc, r)
+	}
+	if err != nil {
+		return err
+	}
+	w.blobs[desc.Digest] = true
+	return nil
+}
+
+// writeArchiveBlob adds a blob to the tar archive. The tar header must be written before
+// the content, so the content is first copied to a temporary file and verified; content
+// which does not match the descriptor never reaches the archive.
+func (w *Writer) writeArchiveBlob(blobPath string, desc ocispec.Descriptor, r io.Reader) error {
+	tmp, err := os.CreateTemp("", "manifest-tool-blob-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if err := copyVerified(tmp, desc, r); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(&tar.Header{
+		Name:     filepath.ToSlash(blobPath),
+		Mode:     0644,
+		Size:     desc.Size,
+		ModTime:  time.Unix(0, 0),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(w.tw, tmp)
+	return err
+}
+
+// writeDirBlob writes a blob to the layout directory unless it is already present; a
+// blob file whose content does not match the descriptor is removed
+func (w *Writer) writeDirBlob(blobPath string, desc ocispec.Descriptor, r io.Reader) error {
+	fullPath := filepath.Join(w.root, blobPath)
+	if _, err := os.Stat(fullPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(fullPath)
+	if err != nil {
+		return err
+	}
+	err = copyVerified(f, desc, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fullPath)
+		return err
+	}
+	return nil
+}
+
+// copyVerified copies the content for a descriptor to dst, returning an error if the
+// content does not match the descriptor's size and digest
+func copyVerified(dst io.Writer, desc ocispec.Descriptor, r io.Reader) error {
+	verifier := desc.Digest.Verifier()
+	// read past the expected size to detect content which is too long
+	n, err := io.Copy(io.MultiWriter(dst, verifier), io.LimitReader(r, desc.Size+1))
+	if err != nil {
+		return err
+	}
+	if n != desc.Size || !verifier.Verified() {
+		return fmt.Errorf("content written for %s does not match its digest", desc.Digest.String())
+	}
+	return nil
+}
+
+// AddReference adds the descriptor to the layout's top-level index with the provided
+// reference name; an existing entry with the same name is replaced
+func (w *Writer) AddReference(desc ocispec.Descriptor, name string) {
+	desc.Annotations = map[string]string{}
+	if name != "" {
+		desc.Annotations[ocispec.AnnotationRefName] = name
+	}
+	manifests := w.index.Manifests[:0]
+	for _, m := range w.index.Manifests {
+		if name == "" || m.Annotations[ocispec.AnnotationRefName] != name {
+			manifests = append(manifests, m)
+		}
+	}
+	w.index.Manifests = append(manifests, desc)
+}
+
+// Close writes the top-level index of the layout and completes the archive, if any
+func (w *Writer) Close() error {
+	ib, err := json.MarshalIndent(w.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.writeFile(IndexFile, ib); err != nil {
+		return err
+	}
+	if w.tw != nil {
+		if err := w.tw.Close(); err != nil {
+			return err
+		}
+		return w.file.Close()
+	}
+	return nil
+}
+
+// Abort discards a tar archive which could not be completed. Blobs already written to a
+// layout directory are kept; the index of the layout is left unchanged.
+func (w *Writer) Abort() {
+	if w.tw != nil {
+		w.file.Close()
+		os.Remove(w.root)
+	}
+}
+
+func (w *Writer) writeFile(name string, content []byte) error {
+	if w.tw != nil {
+		if err := w.tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		_, err := w.tw.Write(content)
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.root, name), content, 0644)
+}
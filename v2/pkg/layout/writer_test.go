@@ -0,0 +1,173 @@
+package layout
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func testBlob(content string) ocispec.Descriptor {
+	return ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString(content),
+		Size:      int64(len(content)),
+	}
+}
+
+func readIndex(t *testing.T, path string) ocispec.Index {
+	ib, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(ib, &index); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestWriteBlobVerification(t *testing.T) {
+	blob := testBlob("manifest")
+	var tests = []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{name: "valid", content: "manifest"},
+		{name: "wrong content", content: "manifesT", err: true},
+		{name: "short content", content: "manif", err: true},
+		{name: "long content", content: "manifests", err: true},
+	}
+	for _, archive := range []bool{false, true} {
+		for _, test := range tests {
+			root := filepath.Join(t.TempDir(), "layout")
+			if archive {
+				root += ".tar"
+			}
+			w, err := NewWriter(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.WriteBlob(blob, strings.NewReader(test.content))
+			if test.err != (err != nil) {
+				t.Errorf("%s (archive %v): expected error %v, got %v", test.name, archive, test.err, err)
+			}
+			// a failed blob does not keep a valid copy from being written
+			if err := w.WriteBlob(blob, strings.NewReader("manifest")); err != nil {
+				t.Errorf("%s (archive %v): unexpected error: %v", test.name, archive, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var blobs []string
+			if archive {
+				blobs = archiveBlobs(t, root)
+			} else {
+				b, err := os.ReadFile(filepath.Join(root, blobPath(blob.Digest)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				blobs = []string{string(b)}
+			}
+			if len(blobs) != 1 || blobs[0] != "manifest" {
+				t.Errorf("%s (archive %v): expected only the valid blob in the layout, got %q", test.name, archive, blobs)
+			}
+		}
+	}
+}
+
+// archiveBlobs returns the content of the blobs in a layout archive, in archive order
+func archiveBlobs(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var blobs []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return blobs
+		}
+		if err != nil {
+			t.Fatalf("invalid archive: %v", err)
+		}
+		if !strings.HasPrefix(hdr.Name, BlobsDir+"/") {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs = append(blobs, string(b))
+	}
+}
+
+func TestWriterReferences(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "layout")
+	first, second, third := testBlob("first"), testBlob("second"), testBlob("third")
+
+	w, err := NewWriter(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AddReference(first, "v1")
+	w.AddReference(second, "latest")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an existing layout directory keeps its index entries; a reference with the same
+	// name replaces the existing entry
+	w, err = NewWriter(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AddReference(third, "latest")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	index := readIndex(t, filepath.Join(root, IndexFile))
+	expected := map[string]digest.Digest{"v1": first.Digest, "latest": third.Digest}
+	if len(index.Manifests) != len(expected) {
+		t.Fatalf("expected %d index entries, got %d", len(expected), len(index.Manifests))
+	}
+	for _, desc := range index.Manifests {
+		name := desc.Annotations[ocispec.AnnotationRefName]
+		if expected[name] != desc.Digest {
+			t.Errorf("expected %s for reference %q, got %s", expected[name], name, desc.Digest)
+		}
+	}
+	lb, err := os.ReadFile(filepath.Join(root, ocispec.ImageLayoutFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(lb), ocispec.ImageLayoutVersion) {
+		t.Errorf("unexpected %s content: %s", ocispec.ImageLayoutFile, lb)
+	}
+}
+
+func TestWriterAbort(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "layout.tar")
+	w, err := NewWriter(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBlob(testBlob("manifest"), strings.NewReader("manifest")); err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("expected the aborted archive to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// AmendManifestList retrieves the existing manifest list/index at the target reference and
+// applies the requested changes: entries matching a removed platform are dropped, and the
+// added images are included, replacing any existing entry for the same platform. Attestation
+// manifests of the remaining entries are kept. A removed platform with an empty variant or OS
+// version matches any variant or OS version. The manifest type of the existing manifest
+// list/index is kept unless a type is provided.
+func AmendManifestList(username, password, target string, add []types.ManifestEntry, remove []ocispec.Platform, insecure, plainHttp bool, manifestType *types.ManifestType, configDir string) (types.ManifestList, *store.MemoryStore, error) {
+	targetRef, err := util.ParseName(target)
+	if err != nil {
+		return types.ManifestList{}, nil, fmt.Errorf("error parsing name for manifest list (%s): %v", target, err)
+	}
+	if _, ok := targetRef.(reference.Tagged); !ok {
+		return types.ManifestList{}, nil, fmt.Errorf("manifest list reference %s must include a tag", target)
+	}
+	err = util.CreateRegistryHost(targetRef, username, password, insecure, plainHttp, configDir, true)
+	if err != nil {
+		return types.ManifestList{}, nil, fmt.Errorf("error creating registry host configuration: %v", err)
+	}
+	memoryStore := store.NewMemoryStore()
+	manifestList := types.ManifestList{
+		Name:      target,
+		Reference: targetRef,
+		Resolver:  util.GetResolver(),
+	}
+
+	logrus.Infof("Retrieving existing manifest list/index %s", targetRef.String())
+	descriptor, existingType, err := fetchManifestList(manifestList.Resolver, memoryStore, targetRef)
+	if err != nil {
+		return types.ManifestList{}, nil, err
+	}
+	manifestList.Type = existingType
+	manifestList.Annotations = indexAnnotations(descriptor, memoryStore)
+	if manifestType != nil {
+		manifestList.Type = *manifestType
+	}
+	existing, existingAttestations := getImagesFromIndex(descriptor, memoryStore)
+
+	manifestDescriptors, attestationDescriptors, _, err := resolveEntries(add, targetRef, manifestList.Resolver, memoryStore, false, insecure, plainHttp, configDir)
+	if err != nil {
+		return types.ManifestList{}, nil, err
+	}
+	manifests, err := amendEntries(existing, remove, manifestDescriptors)
+	if err != nil {
+		return types.ManifestList{}, nil, fmt.Errorf("%v in manifest list/index %s", err, targetRef.String())
+	}
+	var attestations []types.Manifest
+	for _, desc := range existingAttestations {
+		attestations = append(attestations, types.Manifest{Descriptor: desc})
+	}
+	// only keep attestations which refer to a manifest remaining in the list
+	attestations = linkAttestations(manifests, append(attestations, attestationDescriptors...), nil)
+
+	if err := addManifests(&manifestList, memoryStore, manifests, attestations); err != nil {
+		return types.ManifestList{}, nil, err
+	}
+	if len(manifestList.Manifests) == 0 {
+		return types.ManifestList{}, nil, fmt.Errorf("all entries were removed from manifest list/index %s; no manifest list to push", targetRef.String())
+	}
+	return manifestList, memoryStore, nil
+}
+
+// amendEntries returns the existing manifest list/index entries without those matching a
+// removed platform or replaced by an added image for the same platform, followed by the added
+// images. Existing entries without a platform are kept as they can match neither.
+func amendEntries(existing []ocispec.Descriptor, remove []ocispec.Platform, added []types.Manifest) ([]types.Manifest, error) {
+	// drop existing entries for each removed platform
+	for _, platform := range remove {
+		var (
+			kept    []ocispec.Descriptor
+			removed bool
+		)
+		for _, desc := range existing {
+			if desc.Platform != nil && platformMatches(platform, *desc.Platform) {
+				logrus.Infof("removing manifest %s (%s) from manifest list/index", desc.Digest.String(), platforms.Format(*desc.Platform))
+				removed = true
+				continue
+			}
+			kept = append(kept, desc)
+		}
+		if !removed {
+			return nil, fmt.Errorf("no entry for platform %s found", platforms.Format(platform))
+		}
+		existing = kept
+	}
+
+	// added images replace the existing entry for the same platform
+	replaced := map[string]bool{}
+	for _, man := range added {
+		if man.Descriptor.Platform != nil {
+			replaced[getPlatformString(man.Descriptor.Platform)] = true
+		}
+	}
+	var manifests []types.Manifest
+	for _, desc := range existing {
+		if desc.Platform != nil && replaced[getPlatformString(desc.Platform)] {
+			logrus.Infof("replacing manifest %s (%s) in manifest list/index", desc.Digest.String(), platforms.Format(*desc.Platform))
+			continue
+		}
+		manifests = append(manifests, types.Manifest{Descriptor: desc})
+	}
+	return append(manifests, added...), nil
+}
+
+// fetchManifestList retrieves an existing manifest list/index, along with its child manifests
+// and configs, into the memory store and returns its descriptor and manifest type
+func fetchManifestList(resolver remotes.Resolver, ms *store.MemoryStore, ref reference.Named) (ocispec.Descriptor, types.ManifestType, error) {
+	descriptor, err := FetchDescriptor(resolver, ms, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, 0, fmt.Errorf("unable to retrieve manifest list/index %s: %v", ref.String(), err)
+	}
+	switch descriptor.MediaType {
+	case ocispec.MediaTypeImageIndex:
+		return descriptor, types.OCI, nil
+	case types.MediaTypeDockerSchema2ManifestList:
+		return descriptor, types.Docker, nil
+	}
+	return ocispec.Descriptor{}, 0, fmt.Errorf("%s is not a manifest list/index (media type %s)", ref.String(), descriptor.MediaType)
+}
+
+// indexAnnotations returns the annotations of a manifest list/index in the memory store
+func indexAnnotations(desc ocispec.Descriptor, ms *store.MemoryStore) map[string]string {
+	_, db, _ := ms.Get(desc)
+	var index ocispec.Index
+	if err := json.Unmarshal(db, &index); err != nil {
+		return nil
+	}
+	return index.Annotations
+}
+
+// platformMatches returns true if the platform of a manifest list entry matches the requested
+// platform; variant and OS version are only compared when set in the requested platform
+func platformMatches(requested, platform ocispec.Platform) bool {
+	normalized := platforms.Normalize(platform)
+	if normalized.OS != requested.OS || normalized.Architecture != requested.Architecture {
+		return false
+	}
+	if requested.Variant != "" && normalized.Variant != requested.Variant {
+		return false
+	}
+	if requested.OSVersion != "" && platform.OSVersion != requested.OSVersion {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPlatformMatches(t *testing.T) {
+	var tests = []struct {
+		requested ocispec.Platform
+		platform  ocispec.Platform
+		expected  bool
+	}{
+		{requested: ocispec.Platform{OS: "linux", Architecture: "amd64"}, platform: ocispec.Platform{OS: "linux", Architecture: "amd64"}, expected: true},
+		{requested: ocispec.Platform{OS: "linux", Architecture: "amd64"}, platform: ocispec.Platform{OS: "linux", Architecture: "arm64"}, expected: false},
+		{requested: ocispec.Platform{OS: "linux", Architecture: "amd64"}, platform: ocispec.Platform{OS: "windows", Architecture: "amd64"}, expected: false},
+		// an empty variant matches any variant
+		{requested: ocispec.Platform{OS: "linux", Architecture: "arm"}, platform: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, expected: true},
+		{requested: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, platform: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, expected: false},
+		// the entry platform is normalized before comparing
+		{requested: ocispec.Platform{OS: "linux", Architecture: "arm64"}, platform: ocispec.Platform{OS: "linux", Architecture: "aarch64"}, expected: true},
+		// an empty OS version matches any OS version
+		{requested: ocispec.Platform{OS: "windows", Architecture: "amd64"}, platform: ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}, expected: true},
+		{requested: ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.14393.4770"}, platform: ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}, expected: false},
+	}
+	for _, test := range tests {
+		if matches := platformMatches(test.requested, test.platform); matches != test.expected {
+			t.Errorf("platformMatches(%+v, %+v): expected %v, got %v", test.requested, test.platform, test.expected, matches)
+		}
+	}
+}
+
+func TestAmendEntries(t *testing.T) {
+	var (
+		amd64   = testDescriptor("amd64", &ocispec.Platform{OS: "linux", Architecture: "amd64"})
+		arm64   = testDescriptor("arm64", &ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})
+		armv7   = testDescriptor("armv7", &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})
+		noPlat  = testDescriptor("no-platform", nil)
+		newAMD  = testDescriptor("new-amd64", &ocispec.Platform{OS: "linux", Architecture: "amd64"})
+		newS390 = testDescriptor("new-s390x", &ocispec.Platform{OS: "linux", Architecture: "s390x"})
+	)
+	existing := []ocispec.Descriptor{amd64, arm64, noPlat, armv7}
+
+	var tests = []struct {
+		name     string
+		remove   []ocispec.Platform
+		add      []ocispec.Descriptor
+		expected []ocispec.Descriptor
+		err      bool
+	}{
+		{
+			name:     "unchanged",
+			expected: []ocispec.Descriptor{amd64, arm64, noPlat, armv7},
+		},
+		{
+			name:     "add",
+			add:      []ocispec.Descriptor{newS390},
+			expected: []ocispec.Descriptor{amd64, arm64, noPlat, armv7, newS390},
+		},
+		{
+			name:     "replace",
+			add:      []ocispec.Descriptor{newAMD},
+			expected: []ocispec.Descriptor{arm64, noPlat, armv7, newAMD},
+		},
+		{
+			name:     "remove",
+			remove:   []ocispec.Platform{{OS: "linux", Architecture: "arm64"}},
+			expected: []ocispec.Descriptor{amd64, noPlat, armv7},
+		},
+		{
+			name:     "remove and replace",
+			remove:   []ocispec.Platform{{OS: "linux", Architecture: "arm", Variant: "v7"}},
+			add:      []ocispec.Descriptor{newAMD},
+			expected: []ocispec.Descriptor{arm64, noPlat, newAMD},
+		},
+		{
+			name:   "remove missing platform",
+			remove: []ocispec.Platform{{OS: "linux", Architecture: "ppc64le"}},
+			err:    true,
+		},
+		{
+			name:   "remove twice",
+			remove: []ocispec.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "amd64"}},
+			err:    true,
+		},
+	}
+	for _, test := range tests {
+		var added []types.Manifest
+		for _, desc := range test.add {
+			added = append(added, types.Manifest{Descriptor: desc})
+		}
+		manifests, err := amendEntries(existing, test.remove, added)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(manifests) != len(test.expected) {
+			t.Errorf("%s: expected %d entries, got %d", test.name, len(test.expected), len(manifests))
+			continue
+		}
+		for i, desc := range test.expected {
+			if manifests[i].Descriptor.Digest != desc.Digest {
+				t.Errorf("%s: entry %d: expected %s, got %s", test.name, i, desc.Digest, manifests[i].Descriptor.Digest)
+			}
+		}
+	}
+}
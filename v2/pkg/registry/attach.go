@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Attach pushes an OCI artifact manifest of the given artifact type, with each file as a layer
+// and the subject descriptor (an image or manifest list/index) as its subject, to the repository
+// of the reference. The artifact has an empty config; when no files are provided the empty blob
+// is used as its only layer. If the registry has no referrers API support, the referrers tag
+// schema index for the subject is updated with the artifact.
+func Attach(resolver remotes.Resolver, ms *store.MemoryStore, ref reference.Named, subject ocispec.Descriptor, artifactType string, files []types.ArtifactFile, annotations map[string]string) (ocispec.Descriptor, error) {
+	emptyJSON := []byte("{}")
+	config := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeEmptyJSON,
+		Digest:    digest.FromBytes(emptyJSON),
+		Size:      int64(len(emptyJSON)),
+	}
+	ms.Set(config, emptyJSON)
+
+	var layers []ocispec.Descriptor
+	for _, file := range files {
+		content, err := os.ReadFile(file.Path)
+		if err != nil {
+			return ocispec.Descriptor{}, fmt.Errorf("unable to read artifact file %s: %v", file.Path, err)
+		}
+		layer := ocispec.Descriptor{
+			MediaType: file.MediaType,
+			Digest:    digest.FromBytes(content),
+			Size:      int64(len(content)),
+			Annotations: map[string]string{
+				ocispec.AnnotationTitle: filepath.Base(file.Path),
+			},
+		}
+		ms.Set(layer, content)
+		layers = append(layers, layer)
+	}
+	if len(layers) == 0 {
+		layers = append(layers, config)
+	}
+
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: artifactType,
+		Config:       config,
+		Layers:       layers,
+		Subject: &ocispec.Descriptor{
+			MediaType: subject.MediaType,
+			Digest:    subject.Digest,
+			Size:      subject.Size,
+		},
+		Annotations: annotations,
+	}
+	mb, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		MediaType:    ocispec.MediaTypeImageManifest,
+		Digest:       digest.FromBytes(mb),
+		Size:         int64(len(mb)),
+		ArtifactType: artifactType,
+		Annotations:  annotations,
+	}
+	ms.Set(desc, mb)
+
+	artifactRef, err := reference.WithDigest(reference.TrimNamed(ref), desc.Digest)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := push(artifactRef, desc, resolver, ms); err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "Error pushing artifact: %s", artifactRef.String())
+	}
+	logrus.Infof("pushed artifact %s (%s) referring to %s", desc.Digest.String(), artifactType, subject.Digest.String())
+
+	if _, err := fetchReferrers(ref, subject.Digest, ""); errdefs.IsNotImplemented(err) {
+		if err := updateReferrersTag(resolver, ms, ref, subject.Digest, []ocispec.Descriptor{desc}); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	} else if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return desc, nil
+}
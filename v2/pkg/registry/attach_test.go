@@ -0,0 +1,136 @@
+package registry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestAttach(t *testing.T) {
+	dir := t.TempDir()
+	sbomPath := filepath.Join(dir, "sbom.spdx.json")
+	if err := os.WriteFile(sbomPath, []byte(`{"spdxVersion":"SPDX-2.3"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notesPath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notesPath, []byte("release notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyDigest := digest.FromString("{}")
+
+	var tests = []struct {
+		name         string
+		referrersAPI bool
+		files        []types.ArtifactFile
+		// layers are the expected layer media types and titles; the empty blob has no title
+		layers [][2]string
+		err    bool
+	}{
+		{
+			name:         "files",
+			referrersAPI: true,
+			files: []types.ArtifactFile{
+				{Path: sbomPath, MediaType: "application/spdx+json"},
+				{Path: notesPath, MediaType: "text/plain"},
+			},
+			layers: [][2]string{{"application/spdx+json", "sbom.spdx.json"}, {"text/plain", "notes.txt"}},
+		},
+		{
+			name:         "no files",
+			referrersAPI: true,
+			layers:       [][2]string{{ocispec.MediaTypeEmptyJSON, ""}},
+		},
+		{
+			name:   "referrers tag schema",
+			files:  []types.ArtifactFile{{Path: sbomPath, MediaType: "application/spdx+json"}},
+			layers: [][2]string{{"application/spdx+json", "sbom.spdx.json"}},
+		},
+		{
+			name:  "missing file",
+			files: []types.ArtifactFile{{Path: filepath.Join(dir, "missing"), MediaType: "text/plain"}},
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		reg := newTestRegistry(t)
+		reg.referrersAPI = test.referrersAPI
+		ref := reg.ref(t, "app/image")
+		img := testImage(t, reg, "app/image", "v1", "image")
+		annotations := map[string]string{"org.example.build": "42"}
+
+		desc, err := Attach(util.GetResolver(), store.NewMemoryStore(), ref, img, "application/vnd.test.sbom", test.files, annotations)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if desc.ArtifactType != "application/vnd.test.sbom" || desc.Annotations["org.example.build"] != "42" {
+			t.Errorf("%s: unexpected artifact descriptor %+v", test.name, desc)
+		}
+
+		b, mediaType, ok := reg.manifest("app/image", desc.Digest.String())
+		if !ok {
+			t.Errorf("%s: artifact manifest %s not pushed", test.name, desc.Digest)
+			continue
+		}
+		var man ocispec.Manifest
+		if err := json.Unmarshal(b, &man); err != nil {
+			t.Fatal(err)
+		}
+		if mediaType != ocispec.MediaTypeImageManifest || man.ArtifactType != "application/vnd.test.sbom" || man.Annotations["org.example.build"] != "42" {
+			t.Errorf("%s: unexpected artifact manifest %s: %s", test.name, mediaType, b)
+		}
+		// the subject only holds the media type, digest and size of the image
+		expectedSubject := ocispec.Descriptor{MediaType: img.MediaType, Digest: img.Digest, Size: img.Size}
+		if man.Subject == nil || man.Subject.MediaType != expectedSubject.MediaType || man.Subject.Digest != expectedSubject.Digest ||
+			man.Subject.Size != expectedSubject.Size || man.Subject.Platform != nil || man.Subject.Annotations != nil {
+			t.Errorf("%s: expected subject %+v, got %+v", test.name, expectedSubject, man.Subject)
+		}
+		if man.Config.MediaType != ocispec.MediaTypeEmptyJSON || man.Config.Digest != emptyDigest || man.Config.Size != 2 {
+			t.Errorf("%s: expected the empty config, got %+v", test.name, man.Config)
+		}
+		if !reg.hasBlob("app/image", emptyDigest) {
+			t.Errorf("%s: empty config blob not pushed", test.name)
+		}
+
+		if len(man.Layers) != len(test.layers) {
+			t.Errorf("%s: expected %d layers, got %+v", test.name, len(test.layers), man.Layers)
+			continue
+		}
+		for i, layer := range man.Layers {
+			if layer.MediaType != test.layers[i][0] || layer.Annotations[ocispec.AnnotationTitle] != test.layers[i][1] {
+				t.Errorf("%s: expected layer %d %v, got %+v", test.name, i, test.layers[i], layer)
+			}
+			if !reg.hasBlob("app/image", layer.Digest) {
+				t.Errorf("%s: layer %s not pushed", test.name, layer.Digest)
+			}
+		}
+
+		// without referrers API support, the artifact is added to the referrers tag schema index
+		ib, _, tagged := reg.manifest("app/image", referrersTag(img.Digest))
+		if tagged == test.referrersAPI {
+			t.Errorf("%s: expected referrers tag %v, got %v", test.name, !test.referrersAPI, tagged)
+		}
+		if tagged {
+			var index ocispec.Index
+			if err := json.Unmarshal(ib, &index); err != nil {
+				t.Fatal(err)
+			}
+			if len(index.Manifests) != 1 || index.Manifests[0].Digest != desc.Digest || index.Manifests[0].ArtifactType != "application/vnd.test.sbom" {
+				t.Errorf("%s: unexpected referrers index %s", test.name, ib)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// maxStatementSize limits the size of an in-toto statement read for display
+const maxStatementSize = 16 << 20
+
+// PredicateType returns the in-toto predicate type of an attestation manifest layer
+func PredicateType(layer ocispec.Descriptor) string {
+	return layer.Annotations[types.AnnotationInTotoPredicateType]
+}
+
+// IsProvenance returns true if the predicate type is SLSA build provenance
+func IsProvenance(predicateType string) bool {
+	return predicateType == types.PredicateSLSAProvenanceV02 || predicateType == types.PredicateSLSAProvenanceV1
+}
+
+// FetchProvenance reads the SLSA provenance in-toto statement stored in the attestation
+// manifest layer and returns the builder ID and build materials it records
+func FetchProvenance(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor) (types.Provenance, error) {
+	if layer.Size > maxStatementSize {
+		return types.Provenance{}, fmt.Errorf("in-toto statement %s is too large (%d bytes)", layer.Digest.String(), layer.Size)
+	}
+	rc, err := fetcher.Fetch(ctx, layer)
+	if err != nil {
+		return types.Provenance{}, err
+	}
+	defer rc.Close()
+	sb, err := io.ReadAll(io.LimitReader(rc, layer.Size))
+	if err != nil {
+		return types.Provenance{}, err
+	}
+	if digest.FromBytes(sb) != layer.Digest {
+		return types.Provenance{}, fmt.Errorf("in-toto statement content does not match digest %s", layer.Digest.String())
+	}
+
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+		Predicate     struct {
+			// SLSA v0.2
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+			Materials []types.ProvenanceMaterial `json:"materials"`
+			// SLSA v1
+			RunDetails struct {
+				Builder struct {
+					ID string `json:"id"`
+				} `json:"builder"`
+			} `json:"runDetails"`
+			BuildDefinition struct {
+				ResolvedDependencies []types.ProvenanceMaterial `json:"resolvedDependencies"`
+			} `json:"buildDefinition"`
+		} `json:"predicate"`
+	}
+	if err := json.Unmarshal(sb, &statement); err != nil {
+		return types.Provenance{}, fmt.Errorf("could not unmarshal in-toto statement %s: %v", layer.Digest.String(), err)
+	}
+	provenance := types.Provenance{
+		PredicateType: statement.PredicateType,
+	}
+	switch statement.PredicateType {
+	case types.PredicateSLSAProvenanceV02:
+		provenance.BuilderID = statement.Predicate.Builder.ID
+		provenance.Materials = statement.Predicate.Materials
+	case types.PredicateSLSAProvenanceV1:
+		provenance.BuilderID = statement.Predicate.RunDetails.Builder.ID
+		provenance.Materials = statement.Predicate.BuildDefinition.ResolvedDependencies
+	default:
+		return types.Provenance{}, fmt.Errorf("in-toto statement %s has unsupported predicate type %q", layer.Digest.String(), statement.PredicateType)
+	}
+	return provenance, nil
+}
+
+// filterAttestations applies the attestation filter to the attestation manifests collected from
+// the member images. Attestation manifests with only some matching in-toto statements are
+// rewritten to contain only those statements; ones without any matching statement are dropped.
+func filterAttestations(ms *store.MemoryStore, attestations []types.Manifest, filter types.AttestationFilter) ([]types.Manifest, error) {
+	if filter.Drop {
+		if len(attestations) > 0 {
+			logrus.Infof("dropping %d attestation manifests", len(attestations))
+		}
+		return nil, nil
+	}
+	if len(filter.PredicateTypes) == 0 {
+		return attestations, nil
+	}
+	keep := map[string]bool{}
+	for _, predicateType := range filter.PredicateTypes {
+		keep[predicateType] = true
+	}
+
+	var filtered []types.Manifest
+	for _, attestation := range attestations {
+		_, db, _ := ms.Get(attestation.Descriptor)
+		var man ocispec.Manifest
+		if err := json.Unmarshal(db, &man); err != nil {
+			return nil, fmt.Errorf("could not unmarshal attestation object from descriptor '%s': %v", attestation.Descriptor.Digest.String(), err)
+		}
+		var layers []ocispec.Descriptor
+		for _, layer := range man.Layers {
+			if keep[PredicateType(layer)] {
+				layers = append(layers, layer)
+			}
+		}
+		switch len(layers) {
+		case 0:
+			logrus.Infof("dropping attestation manifest %s without any of the requested predicate types", attestation.Descriptor.Digest.String())
+			continue
+		case len(man.Layers):
+			filtered = append(filtered, attestation)
+			continue
+		}
+
+		statements := len(man.Layers)
+		man.Layers = layers
+		mb, err := json.MarshalIndent(man, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		desc := attestation.Descriptor
+		desc.Digest = digest.FromBytes(mb)
+		desc.Size = int64(len(mb))
+		ms.Set(desc, mb)
+		// the rewritten attestation keeps the distribution source of the original for its layers
+		if info, err := ms.Info(context.TODO(), attestation.Descriptor.Digest); err == nil {
+			info.Digest = desc.Digest
+			if _, err := ms.Update(context.TODO(), info, ""); err != nil {
+				logrus.Warnf("couldn't update in-memory store labels for %v: %v", info.Digest, err)
+			}
+		}
+		logrus.Infof("rewrote attestation manifest %s as %s with %d of %d statements", attestation.Descriptor.Digest.String(), desc.Digest.String(), len(layers), statements)
+		filtered = append(filtered, types.Manifest{
+			Descriptor: desc,
+			PushRef:    true,
+			Source:     attestation.Source,
+			Layout:     attestation.Layout,
+		})
+	}
+	if len(attestations) > 0 && len(filtered) == 0 {
+		logrus.Warnf("none of the %d attestation manifests contain a statement with predicate type %s: all attestations are dropped",
+			len(attestations), strings.Join(filter.PredicateTypes, ", "))
+	}
+	return filtered, nil
+}
+
+// linkAttestations returns the attestation manifests which refer to one of the image manifests
+// to be included in a manifest list/index. Attestations referring to a replaced image manifest
+// are rewritten to refer to its replacement, and any attestation which does not refer to an
+// included image manifest (e.g. the image was skipped or taken from another source) is pruned.
+func linkAttestations(manifests, attestations []types.Manifest, replaced map[string]string) []types.Manifest {
+	included := map[string]bool{}
+	for _, man := range manifests {
+		included[man.Descriptor.Digest.String()] = true
+	}
+
+	var linked []types.Manifest
+	seen := map[digest.Digest]bool{}
+	for _, attestation := range attestations {
+		desc := attestation.Descriptor
+		ref, ok := desc.Annotations["vnd.docker.reference.digest"]
+		if !ok {
+			logrus.Warnf("dropping attestation manifest %s without a reference digest annotation", desc.Digest.String())
+			continue
+		}
+		if newRef, ok := replaced[ref]; ok {
+			annotations := map[string]string{}
+			for k, v := range desc.Annotations {
+				annotations[k] = v
+			}
+			annotations["vnd.docker.reference.digest"] = newRef
+			desc.Annotations = annotations
+			ref = newRef
+		}
+		if !included[ref] {
+			logrus.Infof("dropping attestation manifest %s for manifest %s which is not part of the manifest list/index", desc.Digest.String(), ref)
+			continue
+		}
+		if seen[desc.Digest] {
+			// the same source manifest list/index can be used for more than one entry
+			continue
+		}
+		seen[desc.Digest] = true
+		attestation.Descriptor = desc
+		linked = append(linked, attestation)
+	}
+	return linked
+}
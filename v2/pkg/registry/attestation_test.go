@@ -0,0 +1,272 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func testAttestation(name string, ref *ocispec.Descriptor) types.Manifest {
+	desc := testDescriptor(name, &ocispec.Platform{OS: "unknown", Architecture: "unknown"})
+	if ref != nil {
+		desc.Annotations = map[string]string{
+			"vnd.docker.reference.digest": ref.Digest.String(),
+			"vnd.docker.reference.type":   "attestation-manifest",
+		}
+	}
+	return types.Manifest{Descriptor: desc}
+}
+
+func TestLinkAttestations(t *testing.T) {
+	var (
+		amd64     = testDescriptor("amd64", &ocispec.Platform{OS: "linux", Architecture: "amd64"})
+		arm64     = testDescriptor("arm64", &ocispec.Platform{OS: "linux", Architecture: "arm64"})
+		converted = testDescriptor("converted-arm64", &ocispec.Platform{OS: "linux", Architecture: "arm64"})
+	)
+	manifests := []types.Manifest{{Descriptor: amd64}, {Descriptor: converted}}
+	replaced := map[string]string{arm64.Digest.String(): converted.Digest.String()}
+
+	var tests = []struct {
+		name        string
+		attestation types.Manifest
+		expected    string
+	}{
+		{name: "kept", attestation: testAttestation("amd64-attestation", &amd64), expected: amd64.Digest.String()},
+		{name: "relinked", attestation: testAttestation("arm64-attestation", &arm64), expected: converted.Digest.String()},
+		{name: "dangling", attestation: testAttestation("s390x-attestation", &ocispec.Descriptor{Digest: digest.FromString("s390x")})},
+		{name: "no reference", attestation: testAttestation("unreferenced-attestation", nil)},
+	}
+	for _, test := range tests {
+		linked := linkAttestations(manifests, []types.Manifest{test.attestation}, replaced)
+		if test.expected == "" {
+			if len(linked) != 0 {
+				t.Errorf("%s: expected attestation to be dropped, got %d", test.name, len(linked))
+			}
+			continue
+		}
+		if len(linked) != 1 {
+			t.Errorf("%s: expected attestation to be kept, got %d", test.name, len(linked))
+			continue
+		}
+		if linked[0].Descriptor.Digest != test.attestation.Descriptor.Digest {
+			t.Errorf("%s: expected attestation %s, got %s", test.name, test.attestation.Descriptor.Digest, linked[0].Descriptor.Digest)
+		}
+		if ref := linked[0].Descriptor.Annotations["vnd.docker.reference.digest"]; ref != test.expected {
+			t.Errorf("%s: expected reference %s, got %s", test.name, test.expected, ref)
+		}
+	}
+
+	// relinking must not modify the annotations of the source descriptor
+	attestation := testAttestation("arm64-attestation", &arm64)
+	linkAttestations(manifests, []types.Manifest{attestation}, replaced)
+	if ref := attestation.Descriptor.Annotations["vnd.docker.reference.digest"]; ref != arm64.Digest.String() {
+		t.Errorf("expected source annotations to be unchanged, got reference %s", ref)
+	}
+
+	// an attestation of a manifest list/index used for several entries is only included once
+	linked := linkAttestations(manifests, []types.Manifest{testAttestation("amd64-attestation", &amd64), testAttestation("amd64-attestation", &amd64)}, nil)
+	if len(linked) != 1 {
+		t.Errorf("expected duplicate attestations to be included once, got %d", len(linked))
+	}
+}
+
+// storeAttestation stores an attestation manifest with one layer per predicate type
+func storeAttestation(t *testing.T, ms *store.MemoryStore, predicateTypes ...string) types.Manifest {
+	man := ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromString("{}"),
+			Size:      2,
+		},
+	}
+	man.SchemaVersion = 2
+	for _, predicateType := range predicateTypes {
+		man.Layers = append(man.Layers, ocispec.Descriptor{
+			MediaType: "application/vnd.in-toto+json",
+			Digest:    digest.FromString(predicateType),
+			Size:      int64(len(predicateType)),
+			Annotations: map[string]string{
+				types.AnnotationInTotoPredicateType: predicateType,
+			},
+		})
+	}
+	return types.Manifest{Descriptor: storeJSON(t, ms, ocispec.MediaTypeImageManifest, man, nil)}
+}
+
+func TestFilterAttestations(t *testing.T) {
+	const spdx = "https://spdx.dev/Document"
+
+	var tests = []struct {
+		name     string
+		filter   types.AttestationFilter
+		expected [][]string
+	}{
+		{
+			name:     "all",
+			expected: [][]string{{types.PredicateSLSAProvenanceV02, spdx}, {spdx}},
+		},
+		{
+			name:   "drop",
+			filter: types.AttestationFilter{Drop: true},
+		},
+		{
+			name:     "provenance",
+			filter:   types.AttestationFilter{PredicateTypes: []string{types.PredicateSLSAProvenanceV02}},
+			expected: [][]string{{types.PredicateSLSAProvenanceV02}},
+		},
+		{
+			name:     "sbom",
+			filter:   types.AttestationFilter{PredicateTypes: []string{spdx, types.PredicateSLSAProvenanceV1}},
+			expected: [][]string{{spdx}, {spdx}},
+		},
+	}
+	for _, test := range tests {
+		ms := store.NewMemoryStore()
+		attestations := []types.Manifest{
+			storeAttestation(t, ms, types.PredicateSLSAProvenanceV02, spdx),
+			storeAttestation(t, ms, spdx),
+		}
+		filtered, err := filterAttestations(ms, attestations, test.filter)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(filtered) != len(test.expected) {
+			t.Errorf("%s: expected %d attestations, got %d", test.name, len(test.expected), len(filtered))
+			continue
+		}
+		for i, predicateTypes := range test.expected {
+			_, db, ok := ms.Get(filtered[i].Descriptor)
+			if !ok {
+				t.Errorf("%s: attestation %s not found in store", test.name, filtered[i].Descriptor.Digest)
+				continue
+			}
+			if digest.FromBytes(db) != filtered[i].Descriptor.Digest {
+				t.Errorf("%s: stored attestation does not match digest %s", test.name, filtered[i].Descriptor.Digest)
+			}
+			var man ocispec.Manifest
+			if err := json.Unmarshal(db, &man); err != nil {
+				t.Fatal(err)
+			}
+			if len(man.Layers) != len(predicateTypes) {
+				t.Errorf("%s: attestation %d: expected %d statements, got %d", test.name, i, len(predicateTypes), len(man.Layers))
+				continue
+			}
+			for j, predicateType := range predicateTypes {
+				if PredicateType(man.Layers[j]) != predicateType {
+					t.Errorf("%s: attestation %d: expected predicate type %s, got %s", test.name, i, predicateType, PredicateType(man.Layers[j]))
+				}
+			}
+			// only rewritten attestations must be pushed to the target repository
+			rewritten := filtered[i].Descriptor.Digest != attestations[i].Descriptor.Digest
+			if filtered[i].PushRef != rewritten {
+				t.Errorf("%s: attestation %d: expected PushRef %v, got %v", test.name, i, rewritten, filtered[i].PushRef)
+			}
+		}
+	}
+}
+
+func TestFetchProvenance(t *testing.T) {
+	materials := []types.ProvenanceMaterial{
+		{URI: "pkg:docker/alpine@3.18", Digest: map[string]string{"sha256": "1234"}},
+		{URI: "https://github.com/example/app.git", Digest: map[string]string{"sha1": "abcd"}},
+	}
+	var tests = []struct {
+		name       string
+		statement  string
+		size       int64
+		provenance types.Provenance
+		err        bool
+	}{
+		{
+			name: "slsa v0.2",
+			statement: `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","predicate":{` +
+				`"builder":{"id":"https://github.com/example/builder"},"buildType":"https://mobyproject.org/buildkit@v1",` +
+				`"materials":[{"uri":"pkg:docker/alpine@3.18","digest":{"sha256":"1234"}},{"uri":"https://github.com/example/app.git","digest":{"sha1":"abcd"}}]}}`,
+			provenance: types.Provenance{
+				PredicateType: types.PredicateSLSAProvenanceV02,
+				BuilderID:     "https://github.com/example/builder",
+				Materials:     materials,
+			},
+		},
+		{
+			name: "slsa v1",
+			statement: `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1","predicate":{` +
+				`"buildDefinition":{"buildType":"https://mobyproject.org/buildkit@v1","resolvedDependencies":` +
+				`[{"uri":"pkg:docker/alpine@3.18","digest":{"sha256":"1234"}},{"uri":"https://github.com/example/app.git","digest":{"sha1":"abcd"}}]},` +
+				`"runDetails":{"builder":{"id":"https://github.com/example/builder"}}}}`,
+			provenance: types.Provenance{
+				PredicateType: types.PredicateSLSAProvenanceV1,
+				BuilderID:     "https://github.com/example/builder",
+				Materials:     materials,
+			},
+		},
+		{
+			name:      "slsa v1 without dependencies",
+			statement: `{"predicateType":"https://slsa.dev/provenance/v1","predicate":{"runDetails":{"builder":{"id":"builder"}}}}`,
+			provenance: types.Provenance{
+				PredicateType: types.PredicateSLSAProvenanceV1,
+				BuilderID:     "builder",
+			},
+		},
+		{
+			name:      "unsupported predicate type",
+			statement: `{"predicateType":"https://spdx.dev/Document","predicate":{}}`,
+			err:       true,
+		},
+		{
+			name:      "invalid json",
+			statement: `{"predicateType":`,
+			err:       true,
+		},
+		{
+			name:      "digest mismatch",
+			statement: `{"predicateType":"https://slsa.dev/provenance/v1","predicate":{}}`,
+			size:      10,
+			err:       true,
+		},
+		{
+			name:      "too large",
+			statement: `{}`,
+			size:      maxStatementSize + 1,
+			err:       true,
+		},
+	}
+	for _, test := range tests {
+		layer := ocispec.Descriptor{
+			MediaType: "application/vnd.in-toto+json",
+			Digest:    digest.FromString(test.statement),
+			Size:      int64(len(test.statement)),
+		}
+		if test.size != 0 {
+			layer.Size = test.size
+		}
+		fetcher := remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader([]byte(test.statement))), nil
+		})
+		provenance, err := FetchProvenance(context.Background(), fetcher, layer)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(provenance, test.provenance) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.provenance, provenance)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultConcurrency is the number of member images retrieved, and of component
+// references pushed, in parallel unless set otherwise with SetConcurrency
+const DefaultConcurrency = 4
+
+var (
+	concurrencyLock sync.RWMutex
+	concurrency     = DefaultConcurrency
+)
+
+// SetConcurrency sets the number of member images retrieved, and of component references
+// pushed, in parallel when assembling and pushing manifest lists/indexes
+func SetConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", n)
+	}
+	concurrencyLock.Lock()
+	concurrency = n
+	concurrencyLock.Unlock()
+	return nil
+}
+
+// forEach calls fn for every index from 0 to n-1, running up to the configured number of
+// calls in parallel. All calls are made; the error returned is that of the lowest failing
+// index, so the result does not depend on the order in which the calls complete.
+func forEach(n int, fn func(i int) error) error {
+	concurrencyLock.RLock()
+	limit := concurrency
+	concurrencyLock.RUnlock()
+
+	errs := make([]error, n)
+	var g errgroup.Group
+	g.SetLimit(limit)
+	for i := 0; i < n; i++ {
+		i := i
+		g.Go(func() error {
+			errs[i] = fn(i)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach(t *testing.T) {
+	defer func() {
+		_ = SetConcurrency(DefaultConcurrency)
+	}()
+	if err := SetConcurrency(3); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		running, maxRunning int32
+		calls               int32
+	)
+	err := forEach(20, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		// later indexes fail first; the error of the lowest index must be returned
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		if i == 4 || i == 7 || i == 15 {
+			return fmt.Errorf("entry %d failed", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "entry 4 failed" {
+		t.Fatalf("expected the error of entry 4, got %v", err)
+	}
+	if calls != 20 {
+		t.Fatalf("expected 20 calls, got %d", calls)
+	}
+	if maxRunning > 3 {
+		t.Fatalf("expected at most 3 concurrent calls, got %d", maxRunning)
+	}
+
+	if err := forEach(0, func(int) error { return errors.New("unexpected call") }); err != nil {
+		t.Fatalf("unexpected error for no calls: %v", err)
+	}
+	if err := SetConcurrency(0); err == nil {
+		t.Fatal("expected error for a concurrency of 0")
+	}
+}
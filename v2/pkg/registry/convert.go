@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd/images"
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// dockerToOCI maps the Docker v2.2 media types of image manifest components to their OCI equivalents
+var dockerToOCI = map[string]string{
+	types.MediaTypeDockerSchema2Manifest:          ocispec.MediaTypeImageManifest,
+	images.MediaTypeDockerSchema2Config:           ocispec.MediaTypeImageConfig,
+	images.MediaTypeDockerSchema2Layer:            ocispec.MediaTypeImageLayer,
+	images.MediaTypeDockerSchema2LayerGzip:        ocispec.MediaTypeImageLayerGzip,
+	images.MediaTypeDockerSchema2LayerForeign:     ocispec.MediaTypeImageLayerNonDistributable,
+	images.MediaTypeDockerSchema2LayerForeignGzip: ocispec.MediaTypeImageLayerNonDistributableGzip,
+}
+
+// ConvertManifestList retrieves the existing manifest list/index at the target reference so that
+// it can be pushed back to the same tag as the requested manifest type. When convertManifests is
+// set, the platform-specific image manifests are rewritten with the media types of the requested
+// format as well, and attestation manifests are relinked to the converted image manifests.
+// Attestation manifests themselves are never converted as they have no Docker equivalent.
+func ConvertManifestList(username, password, target string, manifestType types.ManifestType, convertManifests, insecure, plainHttp bool, configDir string) (types.ManifestList, *store.MemoryStore, error) {
+	targetRef, err := util.ParseName(target)
+	if err != nil {
+		return types.ManifestList{}, nil, fmt.Errorf("error parsing name for manifest list (%s): %v", target, err)
+	}
+	if _, ok := targetRef.(reference.Tagged); !ok {
+		return types.ManifestList{}, nil, fmt.Errorf("manifest list reference %s must include a tag", target)
+	}
+	err = util.CreateRegistryHost(targetRef, username, password, insecure, plainHttp, configDir, true)
+	if err != nil {
+		return types.ManifestList{}, nil, fmt.Errorf("error creating registry host configuration: %v", err)
+	}
+	memoryStore := store.NewMemoryStore()
+	manifestList := types.ManifestList{
+		Name:      target,
+		Reference: targetRef,
+		Resolver:  util.GetResolver(),
+		Type:      manifestType,
+	}
+
+	logrus.Infof("Retrieving existing manifest list/index %s", targetRef.String())
+	descriptor, _, err := fetchManifestList(manifestList.Resolver, memoryStore, targetRef)
+	if err != nil {
+		return types.ManifestList{}, nil, err
+	}
+	manifestList.Annotations = indexAnnotations(descriptor, memoryStore)
+	existing, existingAttestations := getImagesFromIndex(descriptor, memoryStore)
+
+	var manifests, attestations []types.Manifest
+	// converted image manifests have a new digest which attestations must be relinked to
+	converted := map[string]string{}
+	for _, desc := range existing {
+		if desc.Platform == nil {
+			return types.ManifestList{}, nil, fmt.Errorf("manifest %s in %s has no platform", desc.Digest.String(), targetRef.String())
+		}
+		man := types.Manifest{Descriptor: desc}
+		if convertManifests {
+			newDesc, err := convertManifest(memoryStore, desc, manifestType)
+			if err != nil {
+				return types.ManifestList{}, nil, fmt.Errorf("unable to convert manifest %s: %v", desc.Digest.String(), err)
+			}
+			if newDesc.Digest != desc.Digest {
+				logrus.Infof("converted manifest %s to %s (%s)", desc.Digest.String(), newDesc.Digest.String(), newDesc.MediaType)
+				converted[desc.Digest.String()] = newDesc.Digest.String()
+				man = types.Manifest{Descriptor: newDesc, PushRef: true}
+			}
+		}
+		manifests = append(manifests, man)
+	}
+	for _, desc := range existingAttestations {
+		attestations = append(attestations, types.Manifest{Descriptor: desc})
+	}
+	attestations = linkAttestations(manifests, attestations, converted)
+
+	if err := addManifests(&manifestList, memoryStore, manifests, attestations); err != nil {
+		return types.ManifestList{}, nil, err
+	}
+	return manifestList, memoryStore, nil
+}
+
+// convertManifest rewrites the media types of an image manifest, its config and its layers to
+// those of the requested manifest type and stores the result in the memory store; the
+// descriptor for the (possibly unchanged) manifest is returned
+func convertManifest(ms *store.MemoryStore, desc ocispec.Descriptor, manifestType types.ManifestType) (ocispec.Descriptor, error) {
+	_, db, found := ms.Get(desc)
+	if !found {
+		return ocispec.Descriptor{}, fmt.Errorf("manifest not found in content store")
+	}
+	var man ocispec.Manifest
+	if err := json.Unmarshal(db, &man); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("could not unmarshal manifest object: %v", err)
+	}
+
+	var changed bool
+	mapping := dockerToOCI
+	if manifestType == types.Docker {
+		mapping = map[string]string{}
+		for docker, oci := range dockerToOCI {
+			mapping[oci] = docker
+		}
+		if man.ArtifactType != "" || man.Subject != nil || len(man.Annotations) > 0 {
+			logrus.Warnf("manifest %s has OCI-only fields (artifactType, subject or annotations) which are dropped in the Docker format", desc.Digest.String())
+			changed = true
+		}
+		man.ArtifactType = ""
+		man.Subject = nil
+		man.Annotations = nil
+	}
+	convert := func(mediaType string) (string, error) {
+		if mt, ok := mapping[mediaType]; ok {
+			changed = true
+			return mt, nil
+		}
+		if _, ok := dockerToOCI[mediaType]; ok && manifestType == types.Docker {
+			// already a Docker media type
+			return mediaType, nil
+		}
+		if manifestType == types.OCI {
+			// OCI and custom media types are kept as is in an OCI manifest
+			return mediaType, nil
+		}
+		return "", fmt.Errorf("media type %s cannot be represented in a Docker v2.2 manifest", mediaType)
+	}
+
+	var err error
+	config := man.Config
+	if man.MediaType, err = convert(desc.MediaType); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if man.Config.MediaType, err = convert(man.Config.MediaType); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	for i, layer := range man.Layers {
+		if man.Layers[i].MediaType, err = convert(layer.MediaType); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+	if !changed {
+		return desc, nil
+	}
+
+	if man.Config.MediaType != config.MediaType {
+		// content is looked up by media type as well as digest; store the config under the
+		// converted descriptor so that it is found when pushing or writing the manifest
+		_, cb, found := ms.Get(config)
+		if !found {
+			return ocispec.Descriptor{}, fmt.Errorf("config %s not found in content store", config.Digest.String())
+		}
+		ms.Set(man.Config, cb)
+	}
+	mb, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	newDesc := desc
+	newDesc.MediaType = man.MediaType
+	newDesc.Digest = digest.FromBytes(mb)
+	newDesc.Size = int64(len(mb))
+	ms.Set(newDesc, mb)
+	// the converted manifest shares its layers with the original; copy the distribution
+	// source labels so that they can be mounted if not already present
+	if info, err := ms.Info(context.TODO(), desc.Digest); err == nil {
+		info.Digest = newDesc.Digest
+		if _, err := ms.Update(context.TODO(), info, ""); err != nil {
+			logrus.Warnf("couldn't update in-memory store labels for %v: %v", info.Digest, err)
+		}
+	}
+	return newDesc, nil
+}
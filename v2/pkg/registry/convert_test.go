@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/images"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// storeManifest stores an image manifest and its config with the given media types
+func storeManifest(t *testing.T, ms *store.MemoryStore, mediaType, configType string, layerTypes ...string) ocispec.Descriptor {
+	man := ocispec.Manifest{
+		MediaType: mediaType,
+		Config:    storeJSON(t, ms, configType, ocispec.Platform{OS: "linux", Architecture: "amd64"}, nil),
+	}
+	man.SchemaVersion = 2
+	for i, layerType := range layerTypes {
+		man.Layers = append(man.Layers, ocispec.Descriptor{
+			MediaType: layerType,
+			Digest:    digest.FromString(string(rune('a' + i))),
+			Size:      1,
+		})
+	}
+	return storeJSON(t, ms, mediaType, man, &ocispec.Platform{OS: "linux", Architecture: "amd64"})
+}
+
+// checkConverted verifies that the converted manifest and its config are stored with the
+// expected media types and returns the converted manifest
+func checkConverted(t *testing.T, ms *store.MemoryStore, desc ocispec.Descriptor, mediaType, configType, layerType string) ocispec.Manifest {
+	_, db, found := ms.Get(desc)
+	if !found {
+		t.Fatalf("converted manifest %s not found in store", desc.Digest)
+	}
+	if digest.FromBytes(db) != desc.Digest || int64(len(db)) != desc.Size {
+		t.Fatalf("converted manifest does not match descriptor %s", desc.Digest)
+	}
+	var man ocispec.Manifest
+	if err := json.Unmarshal(db, &man); err != nil {
+		t.Fatal(err)
+	}
+	if desc.MediaType != mediaType || man.MediaType != mediaType {
+		t.Errorf("expected manifest media type %s, got %s (descriptor %s)", mediaType, man.MediaType, desc.MediaType)
+	}
+	if man.Config.MediaType != configType {
+		t.Errorf("expected config media type %s, got %s", configType, man.Config.MediaType)
+	}
+	if _, _, found := ms.Get(man.Config); !found {
+		t.Errorf("config %s not found in store as %s", man.Config.Digest, man.Config.MediaType)
+	}
+	for _, layer := range man.Layers {
+		if layer.MediaType != layerType {
+			t.Errorf("expected layer media type %s, got %s", layerType, layer.MediaType)
+		}
+	}
+	if desc.Platform == nil || desc.Platform.Architecture != "amd64" {
+		t.Errorf("expected the platform to be kept, got %+v", desc.Platform)
+	}
+	return man
+}
+
+func TestConvertManifest(t *testing.T) {
+	ms := store.NewMemoryStore()
+	docker := storeManifest(t, ms, types.MediaTypeDockerSchema2Manifest, images.MediaTypeDockerSchema2Config,
+		images.MediaTypeDockerSchema2LayerGzip, images.MediaTypeDockerSchema2LayerGzip)
+
+	oci, err := convertManifest(ms, docker, types.OCI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oci.Digest == docker.Digest {
+		t.Fatal("expected a new digest for the converted manifest")
+	}
+	man := checkConverted(t, ms, oci, ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageConfig, ocispec.MediaTypeImageLayerGzip)
+	if len(man.Layers) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(man.Layers))
+	}
+
+	// converting to the current format keeps the manifest as is
+	same, err := convertManifest(ms, oci, types.OCI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.Digest != oci.Digest {
+		t.Errorf("expected unchanged digest %s, got %s", oci.Digest, same.Digest)
+	}
+
+	// converting back must restore the original manifest exactly
+	back, err := convertManifest(ms, oci, types.Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkConverted(t, ms, back, types.MediaTypeDockerSchema2Manifest, images.MediaTypeDockerSchema2Config, images.MediaTypeDockerSchema2LayerGzip)
+	if back.Digest != docker.Digest {
+		t.Errorf("expected the original digest %s after converting back, got %s", docker.Digest, back.Digest)
+	}
+}
+
+func TestConvertManifestToDocker(t *testing.T) {
+	var tests = []struct {
+		name      string
+		layerType string
+		err       bool
+	}{
+		{name: "oci layer", layerType: ocispec.MediaTypeImageLayerGzip},
+		{name: "docker layer", layerType: images.MediaTypeDockerSchema2LayerGzip},
+		{name: "zstd layer", layerType: ocispec.MediaTypeImageLayerZstd, err: true},
+		{name: "artifact layer", layerType: "application/vnd.example+json", err: true},
+	}
+	for _, test := range tests {
+		ms := store.NewMemoryStore()
+		desc := storeManifest(t, ms, ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageConfig, test.layerType)
+		converted, err := convertManifest(ms, desc, types.Docker)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		checkConverted(t, ms, converted, types.MediaTypeDockerSchema2Manifest, images.MediaTypeDockerSchema2Config, images.MediaTypeDockerSchema2LayerGzip)
+	}
+}
@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Copy replicates the image referenced by src, including every manifest of a manifest
+// list/index along with all config and layer blobs, to the dst reference. Layers are
+// cross-repo mounted when the source and destination share a registry and are streamed
+// from the source registry otherwise. When withReferrers is set, the referrers (signatures,
+// SBOMs and other artifacts) of the image and of each manifest in a manifest list/index are
+// copied as well.
+func Copy(resolver remotes.Resolver, ms *store.MemoryStore, src, dst reference.Named, withReferrers bool) (string, int, error) {
+	ctx := context.Background()
+
+	desc, err := FetchDescriptor(resolver, ms, src)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "Error fetching source image: %s", src.String())
+	}
+	fetcher, err := resolver.Fetcher(ctx, src.String())
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "Error creating fetcher for source image: %s", src.String())
+	}
+	if err := prepareBlobs(ms, fetcher, desc); err != nil {
+		return "", 0, err
+	}
+
+	baseRef := reference.TrimNamed(dst)
+	subjects := []ocispec.Descriptor{desc}
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		// push each child manifest by digest first so that the destination tag is only
+		// ever updated to point at the complete manifest list/index
+		_, db, _ := ms.Get(desc)
+		var index ocispec.Index
+		if err := json.Unmarshal(db, &index); err != nil {
+			return "", 0, fmt.Errorf("could not unmarshal index from descriptor '%s': %v", desc.Digest.String(), err)
+		}
+		for _, child := range index.Manifests {
+			ref, err := reference.WithDigest(baseRef, child.Digest)
+			if err != nil {
+				return "", 0, errors.Wrapf(err, "Error parsing reference for copy of manifest component: %s", dst.String())
+			}
+			if err := pushAll(ref, child, resolver, ms); err != nil {
+				return "", 0, errors.Wrapf(err, "Error copying manifest component: %s", ref.String())
+			}
+			logrus.Infof("copied manifest component (%s) to destination: %s", child.Digest.String(), ref.String())
+			subjects = append(subjects, child)
+		}
+		if err := push(dst, desc, resolver, ms); err != nil {
+			return "", 0, errors.Wrapf(err, "Error copying manifest list/index to destination: %s", dst.String())
+		}
+	default:
+		if err := pushAll(dst, desc, resolver, ms); err != nil {
+			return "", 0, errors.Wrapf(err, "Error copying image to destination: %s", dst.String())
+		}
+	}
+	logrus.Infof("copied %s (%s) to %s", src.String(), desc.Digest.String(), dst.String())
+	if withReferrers {
+		for _, subject := range subjects {
+			if _, err := copyReferrers(resolver, ms, src, dst, subject.Digest); err != nil {
+				return "", 0, errors.Wrapf(err, "Error copying referrers of %s", subject.Digest.String())
+			}
+		}
+	}
+	return desc.Digest.String(), int(desc.Size), nil
+}
+
+// pushAll pushes the descriptor and all of its children, including any child manifests,
+// skipping only foreign/non-distributable layers
+func pushAll(ref reference.Reference, desc ocispec.Descriptor, resolver remotes.Resolver, ms *store.MemoryStore) error {
+	ctx := context.Background()
+	pusher, err := resolver.Pusher(ctx, ref.String())
+	if err != nil {
+		return err
+	}
+	wrapper := func(f images.Handler) images.Handler {
+		return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+			children, err := f.Handle(ctx, desc)
+			if err != nil {
+				return nil, err
+			}
+			filtered := children[:0]
+			for _, c := range children {
+				if !images.IsNonDistributable(c.MediaType) {
+					filtered = append(filtered, c)
+				}
+			}
+			return filtered, nil
+		})
+	}
+	return remotes.PushContent(ctx, pusher, desc, ms, nil, nil, wrapper)
+}
+
+// prepareBlobs walks the manifests held in the memory store for the given descriptor and
+// sets up the layers of each manifest to be either mounted or copied from the source
+func prepareBlobs(ms *store.MemoryStore, fetcher remotes.Fetcher, desc ocispec.Descriptor) error {
+	_, db, _ := ms.Get(desc)
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		var index ocispec.Index
+		if err := json.Unmarshal(db, &index); err != nil {
+			return fmt.Errorf("could not unmarshal index from descriptor '%s': %v", desc.Digest.String(), err)
+		}
+		for _, child := range index.Manifests {
+			if err := prepareBlobs(ms, fetcher, child); err != nil {
+				return err
+			}
+		}
+	case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+		var man ocispec.Manifest
+		if err := json.Unmarshal(db, &man); err != nil {
+			return fmt.Errorf("could not unmarshal manifest object from descriptor '%s': %v", desc.Digest.String(), err)
+		}
+		labelLayerSources(ms, desc, man)
+		return registerLayerProviders(ms, fetcherProvider{fetcher: fetcher}, desc)
+	default:
+		return fmt.Errorf("cannot copy unknown media type '%s'", desc.MediaType)
+	}
+	return nil
+}
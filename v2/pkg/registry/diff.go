@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Diff compares two images or manifest lists/indexes previously retrieved into the memory
+// store with FetchDescriptor: the annotations of both, the set of platforms they provide,
+// and for each common platform the image manifest digest, layers, config and annotations.
+// A single image manifest is compared as providing the platform of its config.
+func Diff(ms *store.MemoryStore, name1 string, desc1 ocispec.Descriptor, name2 string, desc2 ocispec.Descriptor) (types.ImageDiff, error) {
+	images1, annotations1, err := diffImages(ms, desc1)
+	if err != nil {
+		return types.ImageDiff{}, fmt.Errorf("unable to read %s: %v", name1, err)
+	}
+	images2, annotations2, err := diffImages(ms, desc2)
+	if err != nil {
+		return types.ImageDiff{}, fmt.Errorf("unable to read %s: %v", name2, err)
+	}
+
+	result := types.ImageDiff{
+		Name1:       name1,
+		Name2:       name2,
+		Digest1:     desc1.Digest.String(),
+		Digest2:     desc2.Digest.String(),
+		Identical:   desc1.Digest == desc2.Digest,
+		Annotations: diffValues(annotations1, annotations2),
+		Platforms:   []types.PlatformDiff{},
+	}
+	for _, platform := range sortedPlatforms(images1) {
+		if _, ok := images2[platform]; !ok {
+			result.OnlyIn1 = append(result.OnlyIn1, platform)
+		}
+	}
+	for _, platform := range sortedPlatforms(images2) {
+		img2 := images2[platform]
+		img1, ok := images1[platform]
+		if !ok {
+			result.OnlyIn2 = append(result.OnlyIn2, platform)
+			continue
+		}
+		platformDiff, err := diffImage(ms, img1, img2)
+		if err != nil {
+			return types.ImageDiff{}, err
+		}
+		platformDiff.Platform = platform
+		result.Platforms = append(result.Platforms, platformDiff)
+	}
+
+	result.Equivalent = len(result.Annotations) == 0 && len(result.OnlyIn1) == 0 && len(result.OnlyIn2) == 0
+	for _, platformDiff := range result.Platforms {
+		if len(platformDiff.LayersAdded) > 0 || len(platformDiff.LayersRemoved) > 0 ||
+			len(platformDiff.Config) > 0 || len(platformDiff.Annotations) > 0 {
+			result.Equivalent = false
+		}
+	}
+	return result, nil
+}
+
+// diffImages returns the image manifests of an image or manifest list/index by platform,
+// along with the annotations of the manifest list/index or image manifest
+func diffImages(ms *store.MemoryStore, desc ocispec.Descriptor) (map[string]ocispec.Descriptor, map[string]string, error) {
+	_, db, _ := ms.Get(desc)
+	images := map[string]ocispec.Descriptor{}
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		var index ocispec.Index
+		if err := json.Unmarshal(db, &index); err != nil {
+			return nil, nil, fmt.Errorf("could not unmarshal index from descriptor '%s': %v", desc.Digest.String(), err)
+		}
+		manifests, _ := getImagesFromIndex(desc, ms)
+		for _, man := range manifests {
+			key := "unknown"
+			if man.Platform != nil {
+				key = formatPlatform(*man.Platform)
+			}
+			if _, ok := images[key]; ok {
+				return nil, nil, fmt.Errorf("manifest list/index %s contains more than one manifest for platform %s", desc.Digest.String(), key)
+			}
+			images[key] = man
+		}
+		return images, index.Annotations, nil
+	case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+		var man ocispec.Manifest
+		if err := json.Unmarshal(db, &man); err != nil {
+			return nil, nil, fmt.Errorf("could not unmarshal manifest object from descriptor '%s': %v", desc.Digest.String(), err)
+		}
+		_, cb, _ := ms.Get(man.Config)
+		var conf ocispec.Image
+		if err := json.Unmarshal(cb, &conf); err != nil {
+			return nil, nil, fmt.Errorf("could not unmarshal config object from descriptor '%s': %v", man.Config.Digest.String(), err)
+		}
+		images[formatPlatform(conf.Platform)] = desc
+		return images, man.Annotations, nil
+	}
+	return nil, nil, fmt.Errorf("cannot compare unknown media type '%s'", desc.MediaType)
+}
+
+// diffImage compares two image manifests for the same platform
+func diffImage(ms *store.MemoryStore, desc1, desc2 ocispec.Descriptor) (types.PlatformDiff, error) {
+	result := types.PlatformDiff{
+		Digest1:   desc1.Digest.String(),
+		Digest2:   desc2.Digest.String(),
+		Identical: desc1.Digest == desc2.Digest,
+	}
+	man1, conf1, err := readImage(ms, desc1)
+	if err != nil {
+		return types.PlatformDiff{}, err
+	}
+	man2, conf2, err := readImage(ms, desc2)
+	if err != nil {
+		return types.PlatformDiff{}, err
+	}
+
+	layers1 := map[string]bool{}
+	for _, layer := range man1.Layers {
+		layers1[layer.Digest.String()] = true
+	}
+	layers2 := map[string]bool{}
+	for _, layer := range man2.Layers {
+		layers2[layer.Digest.String()] = true
+		if layers1[layer.Digest.String()] {
+			result.LayersShared = append(result.LayersShared, layer.Digest.String())
+		} else {
+			result.LayersAdded = append(result.LayersAdded, layer.Digest.String())
+		}
+	}
+	for _, layer := range man1.Layers {
+		if !layers2[layer.Digest.String()] {
+			result.LayersRemoved = append(result.LayersRemoved, layer.Digest.String())
+		}
+	}
+	result.Config = diffValues(configValues(conf1), configValues(conf2))
+	result.Annotations = diffValues(man1.Annotations, man2.Annotations)
+	return result, nil
+}
+
+// readImage returns the image manifest and config of the descriptor from the memory store
+func readImage(ms *store.MemoryStore, desc ocispec.Descriptor) (ocispec.Manifest, ocispec.Image, error) {
+	_, db, _ := ms.Get(desc)
+	var man ocispec.Manifest
+	if err := json.Unmarshal(db, &man); err != nil {
+		return ocispec.Manifest{}, ocispec.Image{}, fmt.Errorf("could not unmarshal manifest object from descriptor '%s': %v", desc.Digest.String(), err)
+	}
+	_, cb, _ := ms.Get(man.Config)
+	var conf ocispec.Image
+	if err := json.Unmarshal(cb, &conf); err != nil {
+		return ocispec.Manifest{}, ocispec.Image{}, fmt.Errorf("could not unmarshal config object from descriptor '%s': %v", man.Config.Digest.String(), err)
+	}
+	return man, conf, nil
+}
+
+// configValues flattens the compared settings of an image config into a map; each
+// environment variable and label is a separate setting
+func configValues(conf ocispec.Image) map[string]string {
+	values := map[string]string{}
+	if len(conf.Config.Entrypoint) > 0 {
+		b, _ := json.Marshal(conf.Config.Entrypoint)
+		values["Entrypoint"] = string(b)
+	}
+	if len(conf.Config.Cmd) > 0 {
+		b, _ := json.Marshal(conf.Config.Cmd)
+		values["Cmd"] = string(b)
+	}
+	if conf.Config.User != "" {
+		values["User"] = conf.Config.User
+	}
+	if conf.Config.WorkingDir != "" {
+		values["WorkingDir"] = conf.Config.WorkingDir
+	}
+	for _, env := range conf.Config.Env {
+		name, value, _ := strings.Cut(env, "=")
+		values["Env:"+name] = value
+	}
+	for k, v := range conf.Config.Labels {
+		values["Label:"+k] = v
+	}
+	return values
+}
+
+// diffValues returns the keys whose values differ between both maps, sorted by key
+func diffValues(values1, values2 map[string]string) []types.ValueChange {
+	var changes []types.ValueChange
+	for _, key := range sortedKeys(values1) {
+		v1 := values1[key]
+		v2, ok := values2[key]
+		switch {
+		case !ok:
+			changes = append(changes, types.ValueChange{Key: key, From: &v1})
+		case v1 != v2:
+			changes = append(changes, types.ValueChange{Key: key, From: &v1, To: &v2})
+		}
+	}
+	for _, key := range sortedKeys(values2) {
+		if _, ok := values1[key]; !ok {
+			v2 := values2[key]
+			changes = append(changes, types.ValueChange{Key: key, To: &v2})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// formatPlatform returns the platform in os[(osversion)]/arch[/variant] form
+func formatPlatform(platform ocispec.Platform) string {
+	formatted := platforms.Format(platforms.Normalize(platform))
+	if platform.OSVersion != "" {
+		os, rest, _ := strings.Cut(formatted, "/")
+		formatted = fmt.Sprintf("%s(%s)/%s", os, platform.OSVersion, rest)
+	}
+	return formatted
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPlatforms(images map[string]ocispec.Descriptor) []string {
+	keys := make([]string, 0, len(images))
+	for k := range images {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
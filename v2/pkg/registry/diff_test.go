@@ -0,0 +1,214 @@
+package registry
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// storeImage stores an image manifest with the given config settings, annotations and layers
+// (named by their content) and returns its descriptor with the platform set
+func storeImage(t *testing.T, ms *store.MemoryStore, platform ocispec.Platform, config ocispec.ImageConfig, annotations map[string]string, layers ...string) ocispec.Descriptor {
+	man := ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   ocispec.MediaTypeImageManifest,
+		Config:      storeJSON(t, ms, ocispec.MediaTypeImageConfig, ocispec.Image{Platform: platform, Config: config}, nil),
+		Annotations: annotations,
+	}
+	for _, layer := range layers {
+		man.Layers = append(man.Layers, ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageLayerGzip,
+			Digest:    digest.FromString(layer),
+			Size:      int64(len(layer)),
+		})
+	}
+	return storeJSON(t, ms, ocispec.MediaTypeImageManifest, man, &platform)
+}
+
+// storeIndex stores a manifest list/index of the given media type holding the manifests
+func storeIndex(t *testing.T, ms *store.MemoryStore, mediaType string, annotations map[string]string, manifests ...ocispec.Descriptor) ocispec.Descriptor {
+	return storeJSON(t, ms, mediaType, ocispec.Index{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   mediaType,
+		Manifests:   manifests,
+		Annotations: annotations,
+	}, nil)
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func TestDiff(t *testing.T) {
+	ms := store.NewMemoryStore()
+	var (
+		amd64 = ocispec.Platform{OS: "linux", Architecture: "amd64"}
+		// the v8 variant is the default for arm64 and is normalized away
+		arm64   = ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+		s390x   = ocispec.Platform{OS: "linux", Architecture: "s390x"}
+		windows = ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1"}
+	)
+	amd64v1 := storeImage(t, ms, amd64, ocispec.ImageConfig{
+		Env:    []string{"PATH=/bin", "FOO=1"},
+		Cmd:    []string{"app"},
+		Labels: map[string]string{"version": "1"},
+	}, nil, "base", "app1")
+	amd64v2 := storeImage(t, ms, amd64, ocispec.ImageConfig{
+		Env: []string{"PATH=/bin", "FOO=2", "BAR=x"},
+		Cmd: []string{"app"},
+	}, map[string]string{"org.opencontainers.image.revision": "b"}, "base", "app2")
+	arm64img := storeImage(t, ms, arm64, ocispec.ImageConfig{}, nil, "base-arm")
+	s390ximg := storeImage(t, ms, s390x, ocispec.ImageConfig{}, nil, "base-s390x")
+	windowsImg := storeImage(t, ms, windows, ocispec.ImageConfig{}, nil, "base-windows")
+	attestation := storeJSON(t, ms, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+	}, &ocispec.Platform{OS: "unknown", Architecture: "unknown"})
+	attestation.Annotations = map[string]string{
+		"vnd.docker.reference.type":   "attestation-manifest",
+		"vnd.docker.reference.digest": amd64v2.Digest.String(),
+	}
+
+	index1 := storeIndex(t, ms, ocispec.MediaTypeImageIndex, map[string]string{"created": "1"}, amd64v1, arm64img, s390ximg)
+	list1 := storeIndex(t, ms, types.MediaTypeDockerSchema2ManifestList, map[string]string{"created": "1"}, amd64v1, arm64img, s390ximg)
+	index2 := storeIndex(t, ms, ocispec.MediaTypeImageIndex, map[string]string{"created": "2"}, amd64v2, arm64img, windowsImg, attestation)
+
+	identical := func(platform string, desc ocispec.Descriptor, layers ...string) types.PlatformDiff {
+		diff := types.PlatformDiff{
+			Platform:  platform,
+			Digest1:   desc.Digest.String(),
+			Digest2:   desc.Digest.String(),
+			Identical: true,
+		}
+		for _, layer := range layers {
+			diff.LayersShared = append(diff.LayersShared, digest.FromString(layer).String())
+		}
+		return diff
+	}
+	changedAmd64 := types.PlatformDiff{
+		Platform:      "linux/amd64",
+		Digest1:       amd64v1.Digest.String(),
+		Digest2:       amd64v2.Digest.String(),
+		LayersShared:  []string{digest.FromString("base").String()},
+		LayersAdded:   []string{digest.FromString("app2").String()},
+		LayersRemoved: []string{digest.FromString("app1").String()},
+		Config: []types.ValueChange{
+			{Key: "Env:BAR", To: str("x")},
+			{Key: "Env:FOO", From: str("1"), To: str("2")},
+			{Key: "Label:version", From: str("1")},
+		},
+		Annotations: []types.ValueChange{
+			{Key: "org.opencontainers.image.revision", To: str("b")},
+		},
+	}
+
+	var tests = []struct {
+		name         string
+		desc1, desc2 ocispec.Descriptor
+		expected     types.ImageDiff
+	}{
+		{
+			name:  "identical",
+			desc1: index1,
+			desc2: index1,
+			expected: types.ImageDiff{
+				Identical:  true,
+				Equivalent: true,
+				Platforms: []types.PlatformDiff{
+					identical("linux/amd64", amd64v1, "base", "app1"),
+					identical("linux/arm64", arm64img, "base-arm"),
+					identical("linux/s390x", s390ximg, "base-s390x"),
+				},
+			},
+		},
+		{
+			name:  "docker list and oci index",
+			desc1: list1,
+			desc2: index1,
+			expected: types.ImageDiff{
+				Equivalent: true,
+				Platforms: []types.PlatformDiff{
+					identical("linux/amd64", amd64v1, "base", "app1"),
+					identical("linux/arm64", arm64img, "base-arm"),
+					identical("linux/s390x", s390ximg, "base-s390x"),
+				},
+			},
+		},
+		{
+			name:  "changed index",
+			desc1: index1,
+			desc2: index2,
+			expected: types.ImageDiff{
+				Annotations: []types.ValueChange{{Key: "created", From: str("1"), To: str("2")}},
+				OnlyIn1:     []string{"linux/s390x"},
+				OnlyIn2:     []string{"windows(10.0.17763.1)/amd64"},
+				Platforms: []types.PlatformDiff{
+					changedAmd64,
+					identical("linux/arm64", arm64img, "base-arm"),
+				},
+			},
+		},
+		{
+			name:  "image manifests",
+			desc1: amd64v1,
+			desc2: amd64v2,
+			expected: types.ImageDiff{
+				Annotations: []types.ValueChange{{Key: "org.opencontainers.image.revision", To: str("b")}},
+				Platforms:   []types.PlatformDiff{changedAmd64},
+			},
+		},
+		{
+			name:  "image manifest and index",
+			desc1: arm64img,
+			desc2: index1,
+			expected: types.ImageDiff{
+				Annotations: []types.ValueChange{{Key: "created", To: str("1")}},
+				OnlyIn2:     []string{"linux/amd64", "linux/s390x"},
+				Platforms:   []types.PlatformDiff{identical("linux/arm64", arm64img, "base-arm")},
+			},
+		},
+	}
+	for _, test := range tests {
+		result, err := Diff(ms, "image1", test.desc1, "image2", test.desc2)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		expected := test.expected
+		expected.Name1, expected.Name2 = "image1", "image2"
+		expected.Digest1, expected.Digest2 = test.desc1.Digest.String(), test.desc2.Digest.String()
+		if !reflect.DeepEqual(result, expected) {
+			rb, _ := json.MarshalIndent(result, "", "  ")
+			eb, _ := json.MarshalIndent(expected, "", "  ")
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, eb, rb)
+		}
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	ms := store.NewMemoryStore()
+	amd64 := ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	img1 := storeImage(t, ms, amd64, ocispec.ImageConfig{}, nil, "layer1")
+	img2 := storeImage(t, ms, amd64, ocispec.ImageConfig{}, nil, "layer2")
+	duplicate := storeIndex(t, ms, ocispec.MediaTypeImageIndex, nil, img1, img2)
+	artifact := storeJSON(t, ms, "application/vnd.example+json", map[string]string{}, nil)
+
+	var tests = []struct {
+		name         string
+		desc1, desc2 ocispec.Descriptor
+	}{
+		{name: "duplicate platform", desc1: img1, desc2: duplicate},
+		{name: "unknown media type", desc1: artifact, desc2: img1},
+	}
+	for _, test := range tests {
+		if _, err := Diff(ms, "image1", test.desc1, "image2", test.desc2); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
@@ -7,11 +7,18 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/estesp/manifest-tool/v2/pkg/store"
 	"github.com/estesp/manifest-tool/v2/pkg/types"
+	digest "github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func FetchDescriptor(resolver remotes.Resolver, memoryStore *store.MemoryStore, imageRef reference.Named) (ocispec.Descriptor, error) {
-	return Fetch(context.Background(), memoryStore, types.NewRequest(imageRef, "", allMediaTypes(), resolver))
+	var dgst digest.Digest
+	// a reference which includes a digest (repo@digest or repo:tag@digest) is
+	// resolved by that digest and the fetched content is verified against it
+	if canonical, ok := imageRef.(reference.Canonical); ok {
+		dgst = canonical.Digest()
+	}
+	return Fetch(context.Background(), memoryStore, types.NewRequest(imageRef, dgst, allMediaTypes(), resolver))
 }
 
 func allMediaTypes() []string {
@@ -3,6 +3,7 @@ package registry
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	ccontent "github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/images"
@@ -23,6 +24,11 @@ func Fetch(ctx context.Context, cs *store.MemoryStore, req *types.Request) (ocis
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
+	// when requested by digest, make sure the registry resolved the reference to that exact
+	// content; the content itself is verified against the descriptor digest during dispatch
+	if req.Digest() != "" && desc.Digest != req.Digest() {
+		return ocispec.Descriptor{}, fmt.Errorf("digest mismatch for %s: registry returned %s", req.Reference().String(), desc.Digest.String())
+	}
 	fetcher, err := resolver.Fetcher(ctx, name)
 	if err != nil {
 		return ocispec.Descriptor{}, err
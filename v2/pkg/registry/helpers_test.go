@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testDescriptor returns an image manifest descriptor with a digest derived from the name,
+// for tests which do not need the manifest content
+func testDescriptor(name string, platform *ocispec.Platform) ocispec.Descriptor {
+	return ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString(name),
+		Size:      int64(len(name)),
+		Platform:  platform,
+	}
+}
+
+// storeJSON stores the JSON encoding of v in the memory store and returns its descriptor
+// with the given media type and platform. The content is indented like the manifests
+// written by this package, so that converting or rewriting a stored manifest without
+// changes yields the same digest.
+func storeJSON(t *testing.T, ms *store.MemoryStore, mediaType string, v interface{}, platform *ocispec.Platform) ocispec.Descriptor {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(b),
+		Size:      int64(len(b)),
+		Platform:  platform,
+	}
+	ms.Set(desc, b)
+	return desc
+}
@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ensure interface
+var _ ccontent.Provider = fetcherProvider{}
+
+// fetcherProvider implements a content provider which streams blob content
+// from the source repository of an image via a remote fetcher. It is used to
+// copy layers into a target repository when a cross-repository blob mount is
+// not possible (e.g. when the source image is located in a different registry)
+type fetcherProvider struct {
+	fetcher remotes.Fetcher
+}
+
+func (p fetcherProvider) ReaderAt(ctx context.Context, desc ocispec.Descriptor) (ccontent.ReaderAt, error) {
+	rc, err := p.fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReaderAt{
+		rc:   rc,
+		size: desc.Size,
+	}, nil
+}
+
+// streamReaderAt adapts a fetched blob stream to the ReaderAt interface; the
+// content push path reads blobs sequentially, so reads at any other offset are
+// only supported if the underlying stream can seek
+type streamReaderAt struct {
+	rc     io.ReadCloser
+	size   int64
+	offset int64
+}
+
+func (r *streamReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if off != r.offset {
+		seeker, ok := r.rc.(io.Seeker)
+		if !ok {
+			return 0, fmt.Errorf("unable to read blob stream at offset %d (current offset: %d)", off, r.offset)
+		}
+		if _, err := seeker.Seek(off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		r.offset = off
+	}
+	n, err := io.ReadFull(r.rc, p)
+	r.offset += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *streamReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *streamReaderAt) Close() error {
+	return r.rc.Close()
+}
+
+// registerLayerProviders registers the provider (e.g. a remote fetcher or an OCI layout)
+// as the content source for the layers of the provided manifest descriptors so that they
+// can be copied from the source location when pushed to the target repository
+func registerLayerProviders(ms *store.MemoryStore, provider ccontent.Provider, descs ...ocispec.Descriptor) error {
+	for _, desc := range descs {
+		var man ocispec.Manifest
+		_, db, _ := ms.Get(desc)
+		if err := json.Unmarshal(db, &man); err != nil {
+			return fmt.Errorf("could not unmarshal manifest object from descriptor '%s': %v", desc.Digest.String(), err)
+		}
+		for _, layer := range man.Layers {
+			if skippable(layer.MediaType) {
+				continue
+			}
+			ms.SetProvider(layer.Digest, provider)
+		}
+	}
+	return nil
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"strings"
 
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
 	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/layout"
 	"github.com/estesp/manifest-tool/v2/pkg/store"
 	"github.com/estesp/manifest-tool/v2/pkg/types"
 	"github.com/estesp/manifest-tool/v2/pkg/util"
@@ -14,134 +17,258 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// PushManifestList assembles the manifest list/index described by the input and pushes it,
+// along with any component manifests missing from the target repository, to the registry
 func PushManifestList(username, password string, input types.YAMLInput, ignoreMissing, insecure, plainHttp bool, manifestType types.ManifestType, configDir string) (hash string, length int, err error) {
+	manifestList, memoryStore, err := AssembleManifestList(username, password, input, ignoreMissing, insecure, plainHttp, manifestType, types.AttestationFilter{}, configDir)
+	if err != nil {
+		return hash, length, err
+	}
+	return Push(manifestList, input.Tags, memoryStore)
+}
+
+// AssembleManifestList retrieves all member images of the input and resolves their platforms,
+// returning the manifest list/index entry along with the in-memory store holding the member
+// manifests and configs, ready to be pushed to a registry or written to an OCI image layout.
+// Attestation manifests of the member images are included according to the attestation filter.
+func AssembleManifestList(username, password string, input types.YAMLInput, ignoreMissing, insecure, plainHttp bool, manifestType types.ManifestType, attestationFilter types.AttestationFilter, configDir string) (types.ManifestList, *store.MemoryStore, error) {
 	// resolve the target image reference for the combined manifest list/index
 	targetRef, err := reference.ParseNormalizedNamed(input.Image)
 	if err != nil {
-		return hash, length, fmt.Errorf("error parsing name for manifest list (%s): %v", input.Image, err)
+		return types.ManifestList{}, nil, fmt.Errorf("error parsing name for manifest list (%s): %v", input.Image, err)
 	}
 
 	err = util.CreateRegistryHost(targetRef, username, password, insecure, plainHttp, configDir, true)
 	if err != nil {
-		return hash, length, fmt.Errorf("error creating registry host configuration: %v", err)
+		return types.ManifestList{}, nil, fmt.Errorf("error creating registry host configuration: %v", err)
 	}
+	resolver, tracker := util.GetTrackingResolver()
 	manifestList := types.ManifestList{
-		Name:      input.Image,
-		Reference: targetRef,
-		Resolver:  util.GetResolver(),
-		Type:      manifestType,
+		Name:        input.Image,
+		Reference:   targetRef,
+		Resolver:    resolver,
+		Tracker:     tracker,
+		Type:        manifestType,
+		Annotations: input.Annotations,
 	}
 	// create an in-memory store for OCI descriptors and content used during the push operation
 	memoryStore := store.NewMemoryStore()
 
-	// collect descriptors for images and attestations as we walk the included images
+	manifestDescriptors, attestationDescriptors, skipped, err := resolveEntries(input.Manifests, targetRef, manifestList.Resolver, memoryStore, ignoreMissing, insecure, plainHttp, configDir)
+	if err != nil {
+		return types.ManifestList{}, nil, err
+	}
+	manifestList.Skipped = skipped
+	attestationDescriptors = linkAttestations(manifestDescriptors, attestationDescriptors, nil)
+	attestationDescriptors, err = filterAttestations(memoryStore, attestationDescriptors, attestationFilter)
+	if err != nil {
+		return types.ManifestList{}, nil, err
+	}
+	if err := addManifests(&manifestList, memoryStore, manifestDescriptors, attestationDescriptors); err != nil {
+		return types.ManifestList{}, nil, err
+	}
+
+	if ignoreMissing && len(manifestList.Manifests) == 0 {
+		// we need to verify we at least have one valid entry in the list
+		// otherwise our manifest list will be totally empty
+		return types.ManifestList{}, nil, fmt.Errorf("all entries were skipped due to missing source image references; no manifest list to push")
+	}
+
+	return manifestList, memoryStore, nil
+}
+
+// resolveEntries retrieves the member images for a manifest list/index with the given target,
+// returning the image manifests and attestation manifests to include along with the entries
+// skipped due to the ignoreMissing setting. Member images from a
+// manifest list/index contribute all of their image and attestation manifests.
+// Attestation manifests may refer to images which are not included and must be linked to
+// the resulting image manifests with linkAttestations. Member images are retrieved in
+// parallel; results and errors are reported in the order of the entries.
+func resolveEntries(entries []types.ManifestEntry, targetRef reference.Named, resolver remotes.Resolver, memoryStore *store.MemoryStore, ignoreMissing, insecure, plainHttp bool, configDir string) ([]types.Manifest, []types.Manifest, []types.ManifestEntry, error) {
 	var (
 		manifestDescriptors    []types.Manifest
 		attestationDescriptors []types.Manifest
-		platforms              map[string]ocispec.Descriptor
+		skipped                []types.ManifestEntry
 	)
 
-	logrus.Info("Retrieving digests of member images")
-	for _, img := range input.Manifests {
+	// registries (by domain) for which a registry host configuration exists
+	registryHosts := map[string]bool{
+		reference.Domain(targetRef): true,
+	}
+	// parse all references and configure their registry hosts before retrieving any image
+	refs := make([]reference.Named, len(entries))
+	for i, img := range entries {
+		if layout.IsLayoutReference(img.Image) {
+			continue
+		}
 		ref, err := util.ParseName(img.Image)
 		if err != nil {
-			return hash, length, fmt.Errorf("unable to parse image reference: %s: %v", img.Image, err)
+			return nil, nil, nil, fmt.Errorf("unable to parse image reference: %s: %v", img.Image, err)
 		}
-		if reference.Domain(targetRef) != reference.Domain(ref) {
-			return hash, length, fmt.Errorf("source image (%s) registry does not match target image (%s) registry", ref, targetRef)
+		if !registryHosts[reference.Domain(ref)] {
+			// member images on other registries are only read from; explicit credentials and the
+			// client certificate are meant for the target registry, so these hosts rely on the
+			// Docker config and the certificates directories
+			if err := util.CreateSourceRegistryHost(ref, insecure, plainHttp, configDir); err != nil {
+				return nil, nil, nil, fmt.Errorf("error creating registry host configuration for %s: %v", reference.Domain(ref), err)
+			}
+			registryHosts[reference.Domain(ref)] = true
 		}
-		descriptor, err := FetchDescriptor(util.GetResolver(), memoryStore, ref)
-		if err != nil {
+		refs[i] = ref
+	}
+
+	logrus.Info("Retrieving digests of member images")
+	results := make([]resolvedEntry, len(entries))
+	err := forEach(len(entries), func(i int) error {
+		var err error
+		results[i], err = resolveEntry(entries[i], refs[i], targetRef, resolver, memoryStore)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i, img := range entries {
+		if err := results[i].fetchErr; err != nil {
 			if ignoreMissing {
 				logrus.Warnf("Couldn't access image '%q'. Skipping due to 'ignore missing' configuration.", img.Image)
+				skipped = append(skipped, img)
 				continue
 			}
-			return hash, length, fmt.Errorf("inspect of image %q failed with error: %v", img.Image, err)
+			return nil, nil, nil, fmt.Errorf("inspect of image %q failed with error: %v", img.Image, err)
 		}
+		manifestDescriptors = append(manifestDescriptors, results[i].manifests...)
+		attestationDescriptors = append(attestationDescriptors, results[i].attestations...)
+	}
+	return manifestDescriptors, attestationDescriptors, skipped, nil
+}
 
-		// Check that only member images of type OCI manifest or Docker v2.2 manifest are included
-		switch descriptor.MediaType {
-		case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
-			// check if the index simply has a single image and that other index entries are attestation manifests
-			desc, attestDesc := getImagesFromIndex(descriptor, memoryStore)
-			var pushRef bool
-			if reference.Path(ref) != reference.Path(targetRef) {
-				pushRef = true
-			}
-			for _, d := range desc {
-				man := types.Manifest{
-					Descriptor: d,
-					PushRef:    pushRef,
-				}
-				manifestDescriptors = append(manifestDescriptors, man)
-			}
-			for _, d := range attestDesc {
-				man := types.Manifest{
-					Descriptor: d,
-					PushRef:    pushRef,
-				}
-				attestationDescriptors = append(attestationDescriptors, man)
-			}
-		case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
-			var (
-				man       ocispec.Manifest
-				imgConfig types.Image
-				pushRef   bool
-			)
-			// finalize the platform object that will be used to push with this manifest
-			_, db, _ := memoryStore.Get(descriptor)
-			if err := json.Unmarshal(db, &man); err != nil {
-				return hash, length, fmt.Errorf("could not unmarshal manifest object from descriptor for image '%s': %v", img.Image, err)
-			}
-			_, cb, _ := memoryStore.Get(man.Config)
-			if err := json.Unmarshal(cb, &imgConfig); err != nil {
-				return hash, length, fmt.Errorf("could not unmarshal config object from descriptor for image '%s': %v", img.Image, err)
-			}
-			descriptor.Platform, err = resolvePlatform(descriptor, img, imgConfig)
+// resolvedEntry holds the image and attestation manifests contributed by a member image
+// entry, or the error retrieving its image, which is ignored with the ignoreMissing setting
+type resolvedEntry struct {
+	manifests    []types.Manifest
+	attestations []types.Manifest
+	fetchErr     error
+}
+
+// resolveEntry retrieves the member image of an entry, read from the registry reference ref
+// or, when ref is nil, from an OCI image layout
+func resolveEntry(img types.ManifestEntry, ref, targetRef reference.Named, resolver remotes.Resolver, memoryStore *store.MemoryStore) (resolvedEntry, error) {
+	var (
+		descriptor ocispec.Descriptor
+		provider   ccontent.Provider
+		pushRef    bool
+		layoutRef  string
+		err        error
+	)
+	if ref == nil {
+		// images read from an OCI image layout always need to be uploaded to the target repository
+		descriptor, provider, err = FetchLayout(memoryStore, img.Image)
+		pushRef = true
+		layoutRef = img.Image
+	} else {
+		descriptor, err = FetchDescriptor(resolver, memoryStore, ref)
+		if err == nil {
+			fetcher, err := resolver.Fetcher(context.TODO(), ref.String())
 			if err != nil {
-				return hash, length, fmt.Errorf("unable to create platform object for manifest %s: %v", descriptor.Digest.String(), err)
+				return resolvedEntry{}, fmt.Errorf("unable to create fetcher for image %q: %v", img.Image, err)
 			}
-			if reference.Path(ref) != reference.Path(targetRef) {
-				pushRef = true
+			provider = fetcherProvider{fetcher: fetcher}
+		}
+		// component manifests must be pushed to the target repository when the source
+		// image lives in a different repository or registry than the target
+		if reference.Domain(ref) != reference.Domain(targetRef) || reference.Path(ref) != reference.Path(targetRef) {
+			pushRef = true
+		}
+	}
+	if err != nil {
+		return resolvedEntry{fetchErr: err}, nil
+	}
+
+	var result resolvedEntry
+	// Check that only member images of type OCI manifest or Docker v2.2 manifest are included
+	switch descriptor.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		// check if the index simply has a single image and that other index entries are attestation manifests
+		desc, attestDesc := getImagesFromIndex(descriptor, memoryStore)
+		if err := registerLayerProviders(memoryStore, provider, append(desc, attestDesc...)...); err != nil {
+			return resolvedEntry{}, err
+		}
+		for _, d := range desc {
+			man := types.Manifest{
+				Descriptor: withAnnotations(d, img.Annotations),
+				PushRef:    pushRef,
+				Source:     ref,
+				Layout:     layoutRef,
 			}
-			manifestDescriptors = append(manifestDescriptors, types.Manifest{
-				Descriptor: descriptor,
+			result.manifests = append(result.manifests, man)
+		}
+		for _, d := range attestDesc {
+			man := types.Manifest{
+				Descriptor: d,
 				PushRef:    pushRef,
-			})
-		default:
-			return hash, length, fmt.Errorf("cannot include unknown media type '%s' in a manifest list/index push", descriptor.MediaType)
+				Source:     ref,
+				Layout:     layoutRef,
+			}
+			result.attestations = append(result.attestations, man)
 		}
+	case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+		var (
+			man       ocispec.Manifest
+			imgConfig types.Image
+		)
+		// finalize the platform object that will be used to push with this manifest
+		_, db, _ := memoryStore.Get(descriptor)
+		if err := json.Unmarshal(db, &man); err != nil {
+			return resolvedEntry{}, fmt.Errorf("could not unmarshal manifest object from descriptor for image '%s': %v", img.Image, err)
+		}
+		_, cb, _ := memoryStore.Get(man.Config)
+		if err := json.Unmarshal(cb, &imgConfig); err != nil {
+			return resolvedEntry{}, fmt.Errorf("could not unmarshal config object from descriptor for image '%s': %v", img.Image, err)
+		}
+		descriptor.Platform, err = resolvePlatform(descriptor, img, imgConfig)
+		if err != nil {
+			return resolvedEntry{}, fmt.Errorf("unable to create platform object for manifest %s: %v", descriptor.Digest.String(), err)
+		}
+		if err := registerLayerProviders(memoryStore, provider, descriptor); err != nil {
+			return resolvedEntry{}, err
+		}
+		result.manifests = append(result.manifests, types.Manifest{
+			Descriptor: withAnnotations(descriptor, img.Annotations),
+			PushRef:    pushRef,
+			Source:     ref,
+			Layout:     layoutRef,
+		})
+	default:
+		return resolvedEntry{}, fmt.Errorf("cannot include unknown media type '%s' in a manifest list/index push", descriptor.MediaType)
 	}
+	return result, nil
+}
 
-	platforms = make(map[string]ocispec.Descriptor)
+// addManifests adds the image manifests, followed by the attestation manifests, to the manifest
+// list/index; two image manifests for the same platform cannot be included in a manifest list
+func addManifests(manifestList *types.ManifestList, memoryStore *store.MemoryStore, manifestDescriptors, attestationDescriptors []types.Manifest) error {
+	platforms := make(map[string]ocispec.Descriptor)
 
 	// add image manifests to final index/manifestlist
 	for _, manifest := range manifestDescriptors {
-		// first make sure we haven't already encountered an image with this platform
-		platStr := getPlatformString(manifest.Descriptor.Platform)
-		if otherDesc, ok := platforms[platStr]; ok {
-			return hash, length, fmt.Errorf("cannot include two manifests with the same platform; digest %s already provides platform %s (this digest: %s)", otherDesc.Digest.String(),
-				platStr, manifest.Descriptor.Digest.String())
+		// first make sure we haven't already encountered an image with this platform; entries
+		// without a platform, which an existing index may hold, cannot conflict
+		if manifest.Descriptor.Platform != nil {
+			platStr := getPlatformString(manifest.Descriptor.Platform)
+			if otherDesc, ok := platforms[platStr]; ok {
+				return fmt.Errorf("cannot include two manifests with the same platform; digest %s already provides platform %s (this digest: %s)", otherDesc.Digest.String(),
+					platStr, manifest.Descriptor.Digest.String())
+			}
+			platforms[platStr] = manifest.Descriptor
 		}
-		platforms[platStr] = manifest.Descriptor
 
 		var man ocispec.Manifest
 		_, db, _ := memoryStore.Get(manifest.Descriptor)
 		if err := json.Unmarshal(db, &man); err != nil {
-			return hash, length, fmt.Errorf("could not unmarshal manifest object from descriptor '%s': %v", manifest.Descriptor.Digest.String(), err)
+			return fmt.Errorf("could not unmarshal manifest object from descriptor '%s': %v", manifest.Descriptor.Digest.String(), err)
 		}
 		// set labels for handling distribution source to get automatic cross-repo blob mounting for the layers
-		info, _ := memoryStore.Info(context.TODO(), manifest.Descriptor.Digest)
-		for _, layer := range man.Layers {
-			// only need to handle cross-repo blob mount for distributable layer types
-			if skippable(layer.MediaType) {
-				continue
-			}
-			info.Digest = layer.Digest
-			if _, err := memoryStore.Update(context.TODO(), info, ""); err != nil {
-				logrus.Warnf("couldn't update in-memory store labels for %v: %v", info.Digest, err)
-			}
-		}
+		labelLayerSources(memoryStore, manifest.Descriptor, man)
 		manifestList.Manifests = append(manifestList.Manifests, manifest)
 	}
 
@@ -150,29 +277,45 @@ func PushManifestList(username, password string, input types.YAMLInput, ignoreMi
 		_, db, _ := memoryStore.Get(attestation.Descriptor)
 		var man ocispec.Manifest
 		if err := json.Unmarshal(db, &man); err != nil {
-			return hash, length, fmt.Errorf("could not unmarshal attestation object from descriptor '%s': %v", attestation.Descriptor.Digest.String(), err)
-		}
-		info, _ := memoryStore.Info(context.TODO(), attestation.Descriptor.Digest)
-		for _, layer := range man.Layers {
-			// only need to handle cross-repo blob mount for distributable layer types
-			if skippable(layer.MediaType) {
-				continue
-			}
-			info.Digest = layer.Digest
-			if _, err := memoryStore.Update(context.TODO(), info, ""); err != nil {
-				logrus.Warnf("couldn't update in-memory store labels for %v: %v", info.Digest, err)
-			}
+			return fmt.Errorf("could not unmarshal attestation object from descriptor '%s': %v", attestation.Descriptor.Digest.String(), err)
 		}
+		labelLayerSources(memoryStore, attestation.Descriptor, man)
 		manifestList.Manifests = append(manifestList.Manifests, attestation)
 	}
+	return nil
+}
 
-	if ignoreMissing && len(manifestList.Manifests) == 0 {
-		// we need to verify we at least have one valid entry in the list
-		// otherwise our manifest list will be totally empty
-		return hash, length, fmt.Errorf("all entries were skipped due to missing source image references; no manifest list to push")
+// withAnnotations returns the descriptor with the provided annotations added to any
+// annotations it already carries, replacing existing values for the same keys
+func withAnnotations(desc ocispec.Descriptor, annotations map[string]string) ocispec.Descriptor {
+	if len(annotations) == 0 {
+		return desc
+	}
+	merged := map[string]string{}
+	for k, v := range desc.Annotations {
+		merged[k] = v
 	}
+	for k, v := range annotations {
+		merged[k] = v
+	}
+	desc.Annotations = merged
+	return desc
+}
 
-	return Push(manifestList, input.Tags, memoryStore)
+// labelLayerSources copies the distribution source labels of a manifest to each of its
+// layers so that layers can be cross-repo mounted when the manifest is pushed
+func labelLayerSources(ms *store.MemoryStore, desc ocispec.Descriptor, man ocispec.Manifest) {
+	info, _ := ms.Info(context.TODO(), desc.Digest)
+	for _, layer := range man.Layers {
+		// only need to handle cross-repo blob mount for distributable layer types
+		if skippable(layer.MediaType) {
+			continue
+		}
+		info.Digest = layer.Digest
+		if _, err := ms.Update(context.TODO(), info, ""); err != nil {
+			logrus.Warnf("couldn't update in-memory store labels for %v: %v", info.Digest, err)
+		}
+	}
 }
 
 func resolvePlatform(descriptor ocispec.Descriptor, img types.ManifestEntry, imgConfig types.Image) (*ocispec.Platform, error) {
@@ -24,18 +24,26 @@ import (
 func Push(m types.ManifestList, addedTags []string, ms *store.MemoryStore) (string, int, error) {
 	// push manifest references to target ref (if required)
 	baseRef := reference.TrimNamed(m.Reference)
-	for _, man := range m.Manifests {
-		if man.PushRef {
-			ref, err := reference.WithDigest(baseRef, man.Descriptor.Digest)
-			if err != nil {
-				return "", 0, errors.Wrapf(err, "Error parsing reference for target manifest component push: %s", m.Reference.String())
-			}
-			err = push(ref, man.Descriptor, m.Resolver, ms)
-			if err != nil {
-				return "", 0, errors.Wrapf(err, "Error pushing target manifest component reference: %s", ref.String())
-			}
-			logrus.Infof("pushed manifest component reference (%s) to target namespace: %s", man.Descriptor.Digest.String(), ref.String())
+	refs, err := componentReferences(m)
+	if err != nil {
+		return "", 0, err
+	}
+	// component references are pushed in parallel through the shared resolver; its upload
+	// tracker makes a push of a blob another push is uploading wait for that upload and skip
+	// the blob once it is committed (see containerd's content.OpenWriter and dockerPusher)
+	err = forEach(len(m.Manifests), func(i int) error {
+		ref, man := refs[i], m.Manifests[i]
+		if ref == nil {
+			return nil
+		}
+		if err := push(ref, man.Descriptor, m.Resolver, ms); err != nil {
+			return errors.Wrapf(err, "Error pushing target manifest component reference: %s", ref.String())
 		}
+		logrus.Infof("pushed manifest component reference (%s) to target namespace: %s", man.Descriptor.Digest.String(), ref.String())
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
 	}
 	// build the manifest list/index entry to be pushed and save it in the content store
 	desc, indexJSON, err := buildManifest(m)
@@ -71,6 +79,86 @@ func Push(m types.ManifestList, addedTags []string, ms *store.MemoryStore) (stri
 	return desc.Digest.String(), int(desc.Size), nil
 }
 
+// DryRun builds the manifest list/index entry exactly as Push would, without pushing
+// any content, and returns its descriptor and JSON content along with the component
+// manifest references Push would copy to the target repository
+func DryRun(m types.ManifestList) (ocispec.Descriptor, []byte, []string, error) {
+	desc, indexJSON, err := buildManifest(m)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, nil, errors.Wrap(err, "Error creating manifest list/index JSON")
+	}
+	refs, err := componentReferences(m)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, nil, err
+	}
+	var pushRefs []string
+	for _, ref := range refs {
+		if ref != nil {
+			pushRefs = append(pushRefs, ref.String())
+		}
+	}
+	return desc, indexJSON, pushRefs, nil
+}
+
+// componentReferences returns, for each manifest in the list, the digest reference in the
+// target repository the manifest must be pushed to, or nil if no push is required
+func componentReferences(m types.ManifestList) ([]reference.Canonical, error) {
+	baseRef := reference.TrimNamed(m.Reference)
+	refs := make([]reference.Canonical, len(m.Manifests))
+	for i, man := range m.Manifests {
+		if !man.PushRef {
+			continue
+		}
+		ref, err := reference.WithDigest(baseRef, man.Descriptor.Digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing reference for target manifest component push: %s", m.Reference.String())
+		}
+		refs[i] = ref
+	}
+	return refs, nil
+}
+
+// Transfers returns, for each manifest in the list, how Push transferred the blobs of the
+// manifest to the target repository according to the push status tracker of the manifest
+// list: copied when any blob was uploaded, mounted when blobs were only mounted from
+// other repositories, and existing when all blobs were already present. Manifests without a
+// component reference to push are existing; without a tracker no transfers are returned.
+func Transfers(m types.ManifestList, ms *store.MemoryStore) []string {
+	if m.Tracker == nil {
+		return nil
+	}
+	ctx := context.Background()
+	transfers := make([]string, len(m.Manifests))
+	for i, man := range m.Manifests {
+		transfers[i] = types.TransferExisting
+		if !man.PushRef {
+			continue
+		}
+		_, db, _ := ms.Get(man.Descriptor)
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(db, &manifest); err != nil {
+			logrus.Warnf("could not unmarshal manifest object from descriptor '%s': %v", man.Descriptor.Digest.String(), err)
+			continue
+		}
+		for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+			status, err := m.Tracker.GetStatus(remotes.MakeRefKey(ctx, blob))
+			if err != nil {
+				// blobs which are not pushed, such as foreign layers, have no status
+				continue
+			}
+			switch {
+			case status.MountedFrom != "":
+				if transfers[i] == types.TransferExisting {
+					transfers[i] = types.TransferMounted
+				}
+			case !status.Exists:
+				transfers[i] = types.TransferCopied
+			}
+		}
+	}
+	return transfers
+}
+
 func buildManifest(m types.ManifestList) (ocispec.Descriptor, []byte, error) {
 	var (
 		index     interface{}
@@ -78,11 +166,14 @@ func buildManifest(m types.ManifestList) (ocispec.Descriptor, []byte, error) {
 	)
 	switch m.Type {
 	case types.Docker:
+		if len(m.Annotations) > 0 {
+			logrus.Warnf("index annotations are not supported by the Docker manifest list format and will not be included; use the OCI index type")
+		}
 		index = dockerManifestList(m.Manifests)
 		mediaType = types.MediaTypeDockerSchema2ManifestList
 
 	case types.OCI:
-		index = ociIndex(m.Manifests)
+		index = ociIndex(m.Manifests, m.Annotations)
 		mediaType = ocispec.MediaTypeImageIndex
 	}
 	bytes, err := json.MarshalIndent(index, "", "  ")
@@ -145,11 +236,12 @@ func pushTagOnly(ref reference.Reference, desc ocispec.Descriptor, resolver remo
 	return remotes.PushContent(ctx, pusher, desc, ms, nil, nil, wrapper)
 }
 
-func ociIndex(m []types.Manifest) ocispec.Index {
+func ociIndex(m []types.Manifest, annotations map[string]string) ocispec.Index {
 	index := ocispec.Index{
 		Versioned: specs.Versioned{
 			SchemaVersion: 2,
 		},
+		Annotations: annotations,
 	}
 	for _, man := range m {
 		index.Manifests = append(index.Manifests, man.Descriptor)
@@ -172,11 +264,13 @@ func dockerConvert(m ocispec.Descriptor) manifestlist.ManifestDescriptor {
 	md.Digest = m.Digest
 	md.Size = m.Size
 	md.MediaType = m.MediaType
-	md.Platform.Architecture = m.Platform.Architecture
-	md.Platform.OS = m.Platform.OS
-	md.Platform.Variant = m.Platform.Variant
-	md.Platform.OSFeatures = m.Platform.OSFeatures
-	md.Platform.OSVersion = m.Platform.OSVersion
+	if m.Platform != nil {
+		md.Platform.Architecture = m.Platform.Architecture
+		md.Platform.OS = m.Platform.OS
+		md.Platform.Variant = m.Platform.Variant
+		md.Platform.OSFeatures = m.Platform.OSFeatures
+		md.Platform.OSVersion = m.Platform.OSVersion
+	}
 	md.Annotations = m.Annotations
 	return md
 }
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/estesp/manifest-tool/v2/pkg/layout"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testArchImage stores an image manifest for linux/arch with a config and a single layer
+// in the repository
+func testArchImage(t *testing.T, reg *testRegistry, repo, tag, arch string) ocispec.Descriptor {
+	config := reg.putBlob(repo, ocispec.MediaTypeImageConfig, []byte(`{"architecture":"`+arch+`","os":"linux","rootfs":{"type":"layers"}}`))
+	layer := reg.putBlob(repo, ocispec.MediaTypeImageLayerGzip, []byte("layer of "+arch))
+	return reg.putManifest(t, repo, tag, ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+}
+
+// writeLayoutImage writes an image manifest for linux/arch to a new OCI image layout under
+// the given tag and returns the layout path
+func writeLayoutImage(t *testing.T, arch, tag string) string {
+	root := filepath.Join(t.TempDir(), "layout")
+	w, err := layout.NewWriter(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(mediaType string, content []byte) ocispec.Descriptor {
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+		if err := w.WriteBlob(desc, bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	mb, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    write(ocispec.MediaTypeImageConfig, []byte(`{"architecture":"`+arch+`","os":"linux","rootfs":{"type":"layers"}}`)),
+		Layers:    []ocispec.Descriptor{write(ocispec.MediaTypeImageLayerGzip, []byte("layer of "+arch))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AddReference(write(ocispec.MediaTypeImageManifest, mb), tag)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestPushTransfers(t *testing.T) {
+	reg, other := newTestRegistry(t), newTestRegistry(t)
+	// blobs in another repository of the target registry are mounted
+	testArchImage(t, reg, "app/amd64", "v1", "amd64")
+	// images in the target repository need no push
+	testArchImage(t, reg, "app/target", "v1-arm64", "arm64")
+	// blobs already in the target repository are not transferred again
+	testArchImage(t, reg, "app/shared", "v1", "riscv64")
+	testArchImage(t, reg, "app/target", "", "riscv64")
+	// blobs on another registry, or in an OCI image layout, are copied
+	testArchImage(t, other, "lib/s390x", "v1", "s390x")
+	layoutRef := layout.LayoutScheme + writeLayoutImage(t, "ppc64le", "v1") + ":v1"
+
+	input := types.YAMLInput{
+		Image: reg.host() + "/app/target:v1",
+		Manifests: []types.ManifestEntry{
+			{Image: reg.host() + "/app/amd64:v1"},
+			{Image: reg.host() + "/app/target:v1-arm64"},
+			{Image: reg.host() + "/app/shared:v1"},
+			{Image: other.host() + "/lib/s390x:v1"},
+			{Image: layoutRef},
+		},
+	}
+	m, ms, err := AssembleManifestList("", "", input, false, false, true, types.OCI, types.AttestationFilter{}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Push(m, nil, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct {
+		transfer, source string
+	}{
+		"amd64":   {types.TransferMounted, reg.host() + "/app/amd64:v1"},
+		"arm64":   {types.TransferExisting, reg.host() + "/app/target:v1-arm64"},
+		"riscv64": {types.TransferExisting, reg.host() + "/app/shared:v1"},
+		"s390x":   {types.TransferCopied, other.host() + "/lib/s390x:v1"},
+		"ppc64le": {types.TransferCopied, layoutRef},
+	}
+	transfers := Transfers(m, ms)
+	if len(transfers) != len(expected) || len(m.Manifests) != len(expected) {
+		t.Fatalf("expected %d transfers, got %v", len(expected), transfers)
+	}
+	for i, man := range m.Manifests {
+		arch := man.Descriptor.Platform.Architecture
+		source := man.Layout
+		if man.Source != nil {
+			source = man.Source.String()
+		}
+		if transfers[i] != expected[arch].transfer || source != expected[arch].source {
+			t.Errorf("%s: expected %s from %s, got %s from %s", arch, expected[arch].transfer, expected[arch].source, transfers[i], source)
+		}
+	}
+	if n := reg.requestCount("POST", "from=app/amd64"); n != 2 {
+		t.Errorf("expected the config and layer of the amd64 image to be mounted, got %d mount requests", n)
+	}
+
+	// without a push status tracker, no transfers are known
+	m.Tracker = nil
+	if transfers := Transfers(m, ms); transfers != nil {
+		t.Errorf("expected no transfers without a tracker, got %v", transfers)
+	}
+}
@@ -0,0 +1,330 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxReferrersPages limits how many pages of a referrers response are followed
+const maxReferrersPages = 100
+
+// Referrers returns the descriptors of the manifests (signatures, SBOMs, attestations and
+// other artifacts) in the repository of the image reference which declare the given digest
+// as their subject. The OCI referrers API is used when the registry supports it; otherwise
+// the referrers tag schema ("sha256-<hex>" tag) is used. When artifactType is not empty, only
+// referrers of that artifact type are returned.
+func Referrers(resolver remotes.Resolver, ms *store.MemoryStore, ref reference.Named, dgst digest.Digest, artifactType string) ([]ocispec.Descriptor, error) {
+	referrers, err := fetchReferrers(ref, dgst, artifactType)
+	if errdefs.IsNotImplemented(err) {
+		logrus.Debugf("registry %s has no referrers API support; using referrers tag schema", reference.Domain(ref))
+		referrers, err = fetchReferrersTag(resolver, ms, ref, dgst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if artifactType == "" {
+		return referrers, nil
+	}
+	// the registry may not apply the filter, so it is always applied here
+	var filtered []ocispec.Descriptor
+	for _, desc := range referrers {
+		if desc.ArtifactType == artifactType {
+			filtered = append(filtered, desc)
+		}
+	}
+	return filtered, nil
+}
+
+// fetchReferrers queries the referrers API (GET /v2/<name>/referrers/<digest>) of the registry,
+// following any paginated results; errdefs.ErrNotImplemented is returned if the registry does
+// not support the referrers API
+func fetchReferrers(ref reference.Named, dgst digest.Digest, artifactType string) ([]ocispec.Descriptor, error) {
+	host, err := util.GetRegistryHost(reference.Domain(ref))
+	if err != nil {
+		return nil, err
+	}
+	ctx := docker.ContextWithAppendPullRepositoryScope(context.Background(), reference.Path(ref))
+
+	u := url.URL{
+		Scheme: host.Scheme,
+		Host:   host.Host,
+		Path:   fmt.Sprintf("%s/%s/referrers/%s", host.Path, reference.Path(ref), dgst.String()),
+	}
+	if artifactType != "" {
+		u.RawQuery = url.Values{"artifactType": []string{artifactType}}.Encode()
+	}
+	var referrers []ocispec.Descriptor
+	next := u.String()
+	for page := 0; next != "" && page < maxReferrersPages; page++ {
+		resp, err := doRegistryRequest(ctx, host, next, ocispec.MediaTypeImageIndex)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotFound && page == 0 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("referrers API for %s: %w", reference.Domain(ref), errdefs.ErrNotImplemented)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status from referrers API for %s@%s: %s", ref.Name(), dgst.String(), resp.Status)
+		}
+		if mt := resp.Header.Get("Content-Type"); mt != "" && !strings.HasPrefix(mt, ocispec.MediaTypeImageIndex) {
+			// registries without referrers support may answer any path under /v2 with another response
+			resp.Body.Close()
+			return nil, fmt.Errorf("referrers API for %s returned %s: %w", reference.Domain(ref), mt, errdefs.ErrNotImplemented)
+		}
+		var index ocispec.Index
+		err = json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&index)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse referrers response for %s@%s: %v", ref.Name(), dgst.String(), err)
+		}
+		referrers = append(referrers, index.Manifests...)
+
+		next, err = nextLink(resp, next)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return referrers, nil
+}
+
+// fetchReferrersTag retrieves the referrers index stored under the referrers tag schema
+// ("<alg>-<hex>" tag) for registries without referrers API support
+func fetchReferrersTag(resolver remotes.Resolver, ms *store.MemoryStore, ref reference.Named, dgst digest.Digest) ([]ocispec.Descriptor, error) {
+	tagRef, err := reference.WithTag(reference.TrimNamed(ref), referrersTag(dgst))
+	if err != nil {
+		return nil, err
+	}
+	_, desc, err := resolver.Resolve(context.Background(), tagRef.String())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to resolve referrers tag %s: %v", tagRef.String(), err)
+	}
+	if desc.MediaType != ocispec.MediaTypeImageIndex {
+		return nil, fmt.Errorf("referrers tag %s is not an OCI index (media type %s)", tagRef.String(), desc.MediaType)
+	}
+	fetcher, err := resolver.Fetcher(context.Background(), tagRef.String())
+	if err != nil {
+		return nil, err
+	}
+	rc, err := fetcher.Fetch(context.Background(), desc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch referrers index %s: %v", tagRef.String(), err)
+	}
+	defer rc.Close()
+	db, err := io.ReadAll(io.LimitReader(rc, desc.Size))
+	if err != nil {
+		return nil, err
+	}
+	ms.Set(desc, db)
+	var index ocispec.Index
+	if err := json.Unmarshal(db, &index); err != nil {
+		return nil, fmt.Errorf("unable to parse referrers index %s: %v", tagRef.String(), err)
+	}
+	return index.Manifests, nil
+}
+
+// PushReferrers copies the referrers (signatures, SBOMs and other artifacts) of each component
+// manifest which is pushed to the target repository from another repository, along with their
+// blobs, into the target repository. It returns the number of referrer manifests copied.
+func PushReferrers(m types.ManifestList, ms *store.MemoryStore) (int, error) {
+	var count int
+	for _, man := range m.Manifests {
+		if !man.PushRef || man.Source == nil {
+			continue
+		}
+		n, err := copyReferrers(m.Resolver, ms, man.Source, m.Reference, man.Descriptor.Digest)
+		if err != nil {
+			return count, errors.Wrapf(err, "Error copying referrers of %s from %s", man.Descriptor.Digest.String(), man.Source.Name())
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// copyReferrers copies the manifests in the src repository which refer to the digest, along
+// with their blobs and (recursively) their own referrers, to the dst repository. If the
+// destination registry has no referrers API support, the referrers tag schema index in the
+// destination repository is updated with the copied manifests.
+func copyReferrers(resolver remotes.Resolver, ms *store.MemoryStore, src, dst reference.Named, dgst digest.Digest) (int, error) {
+	referrers, err := Referrers(resolver, ms, src, dgst, "")
+	if err != nil || len(referrers) == 0 {
+		return 0, err
+	}
+	fetcher, err := resolver.Fetcher(context.Background(), src.String())
+	if err != nil {
+		return 0, err
+	}
+	srcBase, dstBase := reference.TrimNamed(src), reference.TrimNamed(dst)
+
+	var count int
+	for _, referrer := range referrers {
+		srcRef, err := reference.WithDigest(srcBase, referrer.Digest)
+		if err != nil {
+			return count, err
+		}
+		desc, err := FetchDescriptor(resolver, ms, srcRef)
+		if err != nil {
+			return count, errors.Wrapf(err, "Error fetching referrer: %s", srcRef.String())
+		}
+		if err := prepareBlobs(ms, fetcher, desc); err != nil {
+			return count, err
+		}
+		dstRef, err := reference.WithDigest(dstBase, referrer.Digest)
+		if err != nil {
+			return count, err
+		}
+		if err := pushAll(dstRef, desc, resolver, ms); err != nil {
+			return count, errors.Wrapf(err, "Error pushing referrer: %s", dstRef.String())
+		}
+		logrus.Infof("copied referrer %s (%s) of %s to %s", referrer.Digest.String(), referrer.ArtifactType, dgst.String(), dstRef.String())
+		count++
+
+		n, err := copyReferrers(resolver, ms, src, dst, referrer.Digest)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	if _, err := fetchReferrers(dst, dgst, ""); errdefs.IsNotImplemented(err) {
+		if err := updateReferrersTag(resolver, ms, dst, dgst, referrers); err != nil {
+			return count, err
+		}
+	} else if err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// updateReferrersTag adds the referrer descriptors to the referrers tag schema index for the
+// digest in the repository, creating the index if it does not exist yet
+func updateReferrersTag(resolver remotes.Resolver, ms *store.MemoryStore, ref reference.Named, dgst digest.Digest, referrers []ocispec.Descriptor) error {
+	existing, err := fetchReferrersTag(resolver, ms, ref, dgst)
+	if err != nil {
+		return err
+	}
+	present := map[digest.Digest]bool{}
+	for _, desc := range existing {
+		present[desc.Digest] = true
+	}
+	index := ocispec.Index{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: existing,
+	}
+	for _, desc := range referrers {
+		if !present[desc.Digest] {
+			index.Manifests = append(index.Manifests, desc)
+		}
+	}
+	if len(index.Manifests) == len(existing) {
+		return nil
+	}
+	ib, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	desc := ocispec.Descriptor{
+		MediaType:   ocispec.MediaTypeImageIndex,
+		Digest:      digest.FromBytes(ib),
+		Size:        int64(len(ib)),
+		Annotations: map[string]string{},
+	}
+	ms.Set(desc, ib)
+	tagRef, err := reference.WithTag(reference.TrimNamed(ref), referrersTag(dgst))
+	if err != nil {
+		return err
+	}
+	if err := pushTagOnly(tagRef, desc, resolver, ms); err != nil {
+		return errors.Wrapf(err, "Error pushing referrers tag: %s", tagRef.String())
+	}
+	logrus.Infof("updated referrers tag %s", tagRef.String())
+	return nil
+}
+
+// referrersTag returns the tag used by the referrers tag schema for the digest
+func referrersTag(dgst digest.Digest) string {
+	return dgst.Algorithm().String() + "-" + dgst.Encoded()
+}
+
+// doRegistryRequest performs an authorized GET request against a registry host, retrying
+// once with the authentication challenge of an unauthorized response
+func doRegistryRequest(ctx context.Context, host docker.RegistryHost, u, accept string) (*http.Response, error) {
+	client := host.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", accept)
+		for k, v := range host.Header {
+			req.Header[k] = v
+		}
+		if host.Authorizer != nil {
+			if err := host.Authorizer.Authorize(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || host.Authorizer == nil || attempt > 0 {
+			return resp, nil
+		}
+		err = host.Authorizer.AddResponses(ctx, []*http.Response{resp})
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// nextLink returns the absolute URL of the next page from the Link header of a
+// paginated registry response, or an empty string on the last page
+func nextLink(resp *http.Response, current string) (string, error) {
+	link := resp.Header.Get("Link")
+	if link == "" {
+		return "", nil
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return "", nil
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := base.Parse(link[start+1 : end])
+	if err != nil {
+		return "", fmt.Errorf("invalid Link header %q: %v", link, err)
+	}
+	return next.String(), nil
+}
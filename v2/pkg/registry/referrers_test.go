@@ -0,0 +1,326 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testImage stores an image manifest with a config and a single layer in the repository
+func testImage(t *testing.T, reg *testRegistry, repo, tag, name string) ocispec.Descriptor {
+	config := reg.putBlob(repo, ocispec.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"}}`))
+	layer := reg.putBlob(repo, ocispec.MediaTypeImageLayerGzip, []byte("layer of "+name))
+	return reg.putManifest(t, repo, tag, ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+}
+
+// testArtifact stores an artifact manifest referring to the subject in the repository
+func testArtifact(t *testing.T, reg *testRegistry, repo, artifactType, name string, subject ocispec.Descriptor) ocispec.Descriptor {
+	config := reg.putBlob(repo, "application/vnd.oci.empty.v1+json", []byte("{}"))
+	layer := reg.putBlob(repo, "application/octet-stream", []byte(name))
+	return reg.putManifest(t, repo, "", ocispec.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: artifactType,
+		Config:       config,
+		Layers:       []ocispec.Descriptor{layer},
+		Subject:      &ocispec.Descriptor{MediaType: subject.MediaType, Digest: subject.Digest, Size: subject.Size},
+	})
+}
+
+// testReferrersIndex stores a referrers tag schema index for the subject in the repository
+func testReferrersIndex(t *testing.T, reg *testRegistry, repo string, subject digest.Digest, referrers ...ocispec.Descriptor) {
+	reg.putManifest(t, repo, referrersTag(subject), ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: referrers,
+	})
+}
+
+func digests(descs []ocispec.Descriptor) map[digest.Digest]bool {
+	m := map[digest.Digest]bool{}
+	for _, desc := range descs {
+		m[desc.Digest] = true
+	}
+	return m
+}
+
+func TestReferrersPagination(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.referrersAPI = true
+	reg.referrersPageSize = 2
+	ref := reg.ref(t, "app/image")
+
+	img := testImage(t, reg, "app/image", "v1", "image")
+	sig1 := testArtifact(t, reg, "app/image", "application/vnd.test.signature", "sig1", img)
+	sig2 := testArtifact(t, reg, "app/image", "application/vnd.test.signature", "sig2", img)
+	sbom := testArtifact(t, reg, "app/image", "application/vnd.test.sbom", "sbom", img)
+	// unrelated artifacts of another image are not returned
+	other := testImage(t, reg, "app/image", "v2", "other")
+	testArtifact(t, reg, "app/image", "application/vnd.test.signature", "other", other)
+
+	referrers, err := Referrers(util.GetResolver(), store.NewMemoryStore(), ref, img.Digest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := digests(referrers)
+	if len(referrers) != 3 || !found[sig1.Digest] || !found[sig2.Digest] || !found[sbom.Digest] {
+		t.Fatalf("expected the 3 referrers of the image, got %+v", referrers)
+	}
+	if n := reg.requestCount(http.MethodGet, "/referrers/"); n != 2 {
+		t.Errorf("expected 2 referrers pages to be requested, got %d", n)
+	}
+
+	// the artifact type filter is applied even if the registry ignores it
+	referrers, err = Referrers(util.GetResolver(), store.NewMemoryStore(), ref, img.Digest, "application/vnd.test.sbom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sbom.Digest {
+		t.Fatalf("expected only the SBOM referrer, got %+v", referrers)
+	}
+}
+
+func TestReferrersTagFallback(t *testing.T) {
+	reg := newTestRegistry(t)
+	ref := reg.ref(t, "app/image")
+
+	img := testImage(t, reg, "app/image", "v1", "image")
+	sig := testArtifact(t, reg, "app/image", "application/vnd.test.signature", "sig", img)
+	sig.ArtifactType = "application/vnd.test.signature"
+	testReferrersIndex(t, reg, "app/image", img.Digest, sig)
+
+	// a 404 for the first page means the registry has no referrers API
+	if _, err := fetchReferrers(ref, img.Digest, ""); !errdefs.IsNotImplemented(err) {
+		t.Fatalf("expected a not implemented error, got %v", err)
+	}
+	referrers, err := Referrers(util.GetResolver(), store.NewMemoryStore(), ref, img.Digest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sig.Digest {
+		t.Fatalf("expected the referrer from the tag schema index, got %+v", referrers)
+	}
+	if n := reg.requestCount(http.MethodHead, "/manifests/"+referrersTag(img.Digest)); n == 0 {
+		t.Error("expected the referrers tag to be fetched")
+	}
+
+	// without a referrers tag there are no referrers
+	other := testImage(t, reg, "app/image", "v2", "other")
+	referrers, err = Referrers(util.GetResolver(), store.NewMemoryStore(), ref, other.Digest, "")
+	if err != nil || len(referrers) != 0 {
+		t.Fatalf("expected no referrers, got %+v (%v)", referrers, err)
+	}
+}
+
+func TestReferrersUnexpectedResponses(t *testing.T) {
+	var tests = []struct {
+		name           string
+		handler        http.HandlerFunc
+		notImplemented bool
+	}{
+		{
+			name: "not found on a later page",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("page") != "" {
+					http.NotFound(w, req)
+					return
+				}
+				w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+				w.Header().Set("Link", `<?page=1>; rel="next"`)
+				_, _ = w.Write([]byte(`{"schemaVersion":2,"manifests":[]}`))
+			},
+		},
+		{
+			name: "other content type",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				_, _ = w.Write([]byte("<html></html>"))
+			},
+			notImplemented: true,
+		},
+		{
+			name: "denied",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+		},
+	}
+	for _, test := range tests {
+		reg := newTestRegistry(t)
+		reg.Config.Handler = test.handler
+		ref := reg.ref(t, "app/image")
+		_, err := fetchReferrers(ref, digest.FromString("image"), "")
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+			continue
+		}
+		if errdefs.IsNotImplemented(err) != test.notImplemented {
+			t.Errorf("%s: expected not implemented %v, got %v", test.name, test.notImplemented, err)
+		}
+	}
+}
+
+func TestCopyReferrers(t *testing.T) {
+	for _, referrersAPI := range []bool{false, true} {
+		src := newTestRegistry(t)
+		src.referrersAPI = true
+		dst := newTestRegistry(t)
+		dst.referrersAPI = referrersAPI
+		srcRef, dstRef := src.ref(t, "app/image"), dst.ref(t, "mirror/image")
+
+		img := testImage(t, src, "app/image", "v1", "image")
+		testImage(t, dst, "mirror/image", "v1", "image")
+		sig := testArtifact(t, src, "app/image", "application/vnd.test.signature", "sig", img)
+		sbom := testArtifact(t, src, "app/image", "application/vnd.test.sbom", "sbom", img)
+		// referrers of referrers are copied as well
+		sbomSig := testArtifact(t, src, "app/image", "application/vnd.test.signature", "sbom-sig", sbom)
+
+		ms := store.NewMemoryStore()
+		n, err := copyReferrers(util.GetResolver(), ms, srcRef, dstRef, img.Digest)
+		if err != nil {
+			t.Fatalf("referrers API %v: %v", referrersAPI, err)
+		}
+		if n != 3 {
+			t.Errorf("referrers API %v: expected 3 referrers to be copied, got %d", referrersAPI, n)
+		}
+		for _, desc := range []ocispec.Descriptor{sig, sbom, sbomSig} {
+			b, _, ok := dst.manifest("mirror/image", desc.Digest.String())
+			if !ok {
+				t.Errorf("referrers API %v: referrer %s not copied", referrersAPI, desc.Digest)
+				continue
+			}
+			var man ocispec.Manifest
+			if err := json.Unmarshal(b, &man); err != nil {
+				t.Fatal(err)
+			}
+			for _, blob := range append([]ocispec.Descriptor{man.Config}, man.Layers...) {
+				if !dst.hasBlob("mirror/image", blob.Digest) {
+					t.Errorf("referrers API %v: blob %s of referrer %s not copied", referrersAPI, blob.Digest, desc.Digest)
+				}
+			}
+		}
+
+		// registries without referrers API support get referrers tag schema indexes
+		for subject, expected := range map[digest.Digest][]ocispec.Descriptor{
+			img.Digest:  {sig, sbom},
+			sbom.Digest: {sbomSig},
+		} {
+			b, _, ok := dst.manifest("mirror/image", referrersTag(subject))
+			if referrersAPI {
+				if ok {
+					t.Errorf("unexpected referrers tag for %s with referrers API support", subject)
+				}
+				continue
+			}
+			if !ok {
+				t.Errorf("no referrers tag for %s", subject)
+				continue
+			}
+			var index ocispec.Index
+			if err := json.Unmarshal(b, &index); err != nil {
+				t.Fatal(err)
+			}
+			found := digests(index.Manifests)
+			if len(index.Manifests) != len(expected) {
+				t.Errorf("expected %d entries in referrers tag for %s, got %d", len(expected), subject, len(index.Manifests))
+			}
+			for _, desc := range expected {
+				if !found[desc.Digest] {
+					t.Errorf("referrer %s missing from referrers tag for %s", desc.Digest, subject)
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateReferrersTag(t *testing.T) {
+	reg := newTestRegistry(t)
+	ref := reg.ref(t, "app/image")
+	img := testImage(t, reg, "app/image", "v1", "image")
+	sig := testArtifact(t, reg, "app/image", "application/vnd.test.signature", "sig", img)
+	sbom := testArtifact(t, reg, "app/image", "application/vnd.test.sbom", "sbom", img)
+	tag := "/manifests/" + referrersTag(img.Digest)
+
+	// the index is created if it does not exist
+	if err := updateReferrersTag(util.GetResolver(), store.NewMemoryStore(), ref, img.Digest, []ocispec.Descriptor{sig}); err != nil {
+		t.Fatal(err)
+	}
+	// existing entries are kept and new ones added
+	if err := updateReferrersTag(util.GetResolver(), store.NewMemoryStore(), ref, img.Digest, []ocispec.Descriptor{sig, sbom}); err != nil {
+		t.Fatal(err)
+	}
+	b, mediaType, ok := reg.manifest("app/image", referrersTag(img.Digest))
+	if !ok {
+		t.Fatal("referrers tag not pushed")
+	}
+	if mediaType != ocispec.MediaTypeImageIndex {
+		t.Errorf("expected an OCI index, got %s", mediaType)
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 2 || index.Manifests[0].Digest != sig.Digest || index.Manifests[1].Digest != sbom.Digest {
+		t.Fatalf("expected the signature and SBOM in the referrers index, got %+v", index.Manifests)
+	}
+	if n := reg.requestCount(http.MethodPut, tag); n != 2 {
+		t.Errorf("expected 2 pushes of the referrers tag, got %d", n)
+	}
+
+	// the index is not pushed again when all referrers are already present
+	if err := updateReferrersTag(util.GetResolver(), store.NewMemoryStore(), ref, img.Digest, []ocispec.Descriptor{sbom}); err != nil {
+		t.Fatal(err)
+	}
+	if n := reg.requestCount(http.MethodPut, tag); n != 2 {
+		t.Errorf("expected no further push of the referrers tag, got %d pushes", n)
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	const current = "http://registry.example.com/v2/app/referrers/sha256:abcd"
+	var tests = []struct {
+		link     string
+		expected string
+		err      bool
+	}{
+		{link: "", expected: ""},
+		{link: `</v2/app/referrers/sha256:abcd?last=x>; rel="next"`, expected: "http://registry.example.com/v2/app/referrers/sha256:abcd?last=x"},
+		{link: `<https://other.example.com/page2>; rel="next"`, expected: "https://other.example.com/page2"},
+		{link: `<?n=10&last=y>; rel="next"`, expected: "http://registry.example.com/v2/app/referrers/sha256:abcd?n=10&last=y"},
+		{link: `</v2/app/referrers/sha256:abcd?last=x>; rel="prev"`, expected: ""},
+		{link: `malformed`, expected: ""},
+		{link: `<http://[::1>; rel="next"`, err: true},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if test.link != "" {
+			resp.Header.Set("Link", test.link)
+		}
+		next, err := nextLink(resp, current)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.link)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.link, err)
+			continue
+		}
+		if next != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.link, test.expected, next)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testRegistry is an in-memory registry implementing the parts of the OCI distribution API
+// used by manifest-tool: manifests, blobs (monolithic uploads and cross-repository mounts
+// only), tags and, optionally, the referrers API with pagination
+type testRegistry struct {
+	*httptest.Server
+	// referrersAPI enables the referrers API; without it referrers requests return 404
+	referrersAPI bool
+	// referrersPageSize splits referrers responses into pages of this size when not 0
+	referrersPageSize int
+
+	mu         sync.Mutex
+	content    map[string]map[digest.Digest][]byte
+	mediaTypes map[string]map[digest.Digest]string
+	tags       map[string]map[string]digest.Digest
+	requests   []string
+	uploads    int
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{
+		content:    map[string]map[digest.Digest][]byte{},
+		mediaTypes: map[string]map[digest.Digest]string{},
+		tags:       map[string]map[string]digest.Digest{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// host returns the host:port of the registry
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// ref parses a reference to the registry and configures its registry host for plain HTTP
+func (r *testRegistry) ref(t *testing.T, name string) reference.Named {
+	ref, err := reference.ParseNormalizedNamed(r.host() + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := util.CreateRegistryHost(ref, "", "", false, true, t.TempDir(), true); err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+// putBlob stores a blob in the repository and returns its descriptor
+func (r *testRegistry) putBlob(repo, mediaType string, content []byte) ocispec.Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dgst := digest.FromBytes(content)
+	r.store(repo, dgst, content)
+	return ocispec.Descriptor{MediaType: mediaType, Digest: dgst, Size: int64(len(content))}
+}
+
+// putManifest stores a manifest or index in the repository, tagging it if tag is not empty
+func (r *testRegistry) putManifest(t *testing.T, repo, tag string, v interface{}) ocispec.Descriptor {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versioned struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(b, &versioned); err != nil || versioned.MediaType == "" {
+		t.Fatalf("manifest without media type: %s", b)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dgst := digest.FromBytes(b)
+	r.store(repo, dgst, b)
+	r.mediaTypes[repo][dgst] = versioned.MediaType
+	if tag != "" {
+		r.tags[repo][tag] = dgst
+	}
+	return ocispec.Descriptor{MediaType: versioned.MediaType, Digest: dgst, Size: int64(len(b))}
+}
+
+// manifest returns the manifest stored in the repository for a tag or digest
+func (r *testRegistry) manifest(repo, ref string) ([]byte, string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dgst, ok := r.tags[repo][ref]
+	if !ok {
+		dgst = digest.Digest(ref)
+	}
+	mediaType, ok := r.mediaTypes[repo][dgst]
+	if !ok {
+		return nil, "", false
+	}
+	return r.content[repo][dgst], mediaType, true
+}
+
+// hasBlob returns true if the repository holds the blob or manifest
+func (r *testRegistry) hasBlob(repo string, dgst digest.Digest) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.content[repo][dgst]
+	return ok
+}
+
+// requestCount returns the number of requests made with the method whose path contains s
+func (r *testRegistry) requestCount(method, s string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, req := range r.requests {
+		if strings.HasPrefix(req, method+" ") && strings.Contains(req, s) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *testRegistry) store(repo string, dgst digest.Digest, content []byte) {
+	if r.content[repo] == nil {
+		r.content[repo] = map[digest.Digest][]byte{}
+		r.mediaTypes[repo] = map[digest.Digest]string{}
+		r.tags[repo] = map[string]digest.Digest{}
+	}
+	r.content[repo][dgst] = content
+}
+
+func (r *testRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.RequestURI())
+	r.mu.Unlock()
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if p == "" || p == req.URL.Path {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	for _, route := range []string{"/manifests/", "/blobs/uploads/", "/blobs/", "/referrers/"} {
+		if i := strings.LastIndex(p, route); i > 0 {
+			repo, arg := p[:i], p[i+len(route):]
+			switch route {
+			case "/manifests/":
+				r.serveManifest(w, req, repo, arg)
+			case "/blobs/uploads/":
+				r.serveUpload(w, req, repo, arg)
+			case "/blobs/":
+				r.serveBlob(w, req, repo, digest.Digest(arg))
+			case "/referrers/":
+				r.serveReferrers(w, req, repo, digest.Digest(arg))
+			}
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
+
+func (r *testRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repo, ref string) {
+	if req.Method == http.MethodPut {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dgst := digest.FromBytes(b)
+		if d, err := digest.Parse(ref); err == nil && d != dgst {
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		r.mu.Lock()
+		r.store(repo, dgst, b)
+		r.mediaTypes[repo][dgst] = req.Header.Get("Content-Type")
+		if _, err := digest.Parse(ref); err != nil {
+			r.tags[repo][ref] = dgst
+		}
+		r.mu.Unlock()
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	b, mediaType, ok := r.manifest(repo, ref)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(b).String())
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(b)
+	}
+}
+
+func (r *testRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repo, id string) {
+	switch req.Method {
+	case http.MethodPost:
+		if mount, from := digest.Digest(req.URL.Query().Get("mount")), req.URL.Query().Get("from"); mount != "" && from != "" {
+			r.mu.Lock()
+			b, ok := r.content[from][mount]
+			if ok {
+				r.store(repo, mount, b)
+			}
+			r.mu.Unlock()
+			if ok {
+				w.Header().Set("Docker-Content-Digest", mount.String())
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		r.mu.Lock()
+		r.uploads++
+		id = strconv.Itoa(r.uploads)
+		r.mu.Unlock()
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dgst := digest.FromBytes(b)
+		if req.URL.Query().Get("digest") != dgst.String() {
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		r.mu.Lock()
+		r.store(repo, dgst, b)
+		r.mu.Unlock()
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *testRegistry) serveBlob(w http.ResponseWriter, req *http.Request, repo string, dgst digest.Digest) {
+	r.mu.Lock()
+	b, ok := r.content[repo][dgst]
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(b)
+	}
+}
+
+func (r *testRegistry) serveReferrers(w http.ResponseWriter, req *http.Request, repo string, dgst digest.Digest) {
+	if !r.referrersAPI {
+		http.NotFound(w, req)
+		return
+	}
+	var referrers []ocispec.Descriptor
+	r.mu.Lock()
+	for d, mediaType := range r.mediaTypes[repo] {
+		var man ocispec.Manifest
+		if err := json.Unmarshal(r.content[repo][d], &man); err != nil || man.Subject == nil || man.Subject.Digest != dgst {
+			continue
+		}
+		artifactType := man.ArtifactType
+		if artifactType == "" {
+			artifactType = man.Config.MediaType
+		}
+		referrers = append(referrers, ocispec.Descriptor{
+			MediaType:    mediaType,
+			Digest:       d,
+			Size:         int64(len(r.content[repo][d])),
+			ArtifactType: artifactType,
+			Annotations:  man.Annotations,
+		})
+	}
+	r.mu.Unlock()
+	sort.Slice(referrers, func(i, j int) bool { return referrers[i].Digest < referrers[j].Digest })
+
+	if r.referrersPageSize > 0 {
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		start, end := page*r.referrersPageSize, (page+1)*r.referrersPageSize
+		if end < len(referrers) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/%s/referrers/%s?page=%d>; rel="next"`, repo, dgst, page+1))
+		} else {
+			end = len(referrers)
+		}
+		if start > end {
+			start = end
+		}
+		referrers = referrers[start:end]
+	}
+	b, _ := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: referrers,
+	})
+	w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+	_, _ = w.Write(b)
+}
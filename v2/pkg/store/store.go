@@ -28,12 +28,24 @@ type labelStore struct {
 	labels map[digest.Digest]map[string]string
 }
 
+type providerStore struct {
+	l         sync.RWMutex
+	providers map[digest.Digest]ccontent.Provider
+}
+
+type nameStore struct {
+	l       sync.RWMutex
+	nameMap map[string]ocispec.Descriptor
+}
+
 // MemoryStore implements a simple in-memory content store for labels and
-// descriptors (and associated content for manifests and configs)
+// descriptors (and associated content for manifests and configs); it is safe
+// for concurrent use
 type MemoryStore struct {
-	store   *memory.Store
-	labels  labelStore
-	nameMap map[string]ocispec.Descriptor
+	store     *memory.Store
+	labels    labelStore
+	providers providerStore
+	names     nameStore
 }
 
 func newLabelStore() labelStore {
@@ -42,14 +54,27 @@ func newLabelStore() labelStore {
 	}
 }
 
+func newProviderStore() providerStore {
+	return providerStore{
+		providers: map[digest.Digest]ccontent.Provider{},
+	}
+}
+
+func newNameStore() nameStore {
+	return nameStore{
+		nameMap: map[string]ocispec.Descriptor{},
+	}
+}
+
 // NewMemoryStore creates a memory store that implements the proper
 // content interfaces to support simple push/inspect operations on
 // containerd's content in a memory-only context
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		store:   memory.New(),
-		labels:  newLabelStore(),
-		nameMap: map[string]ocispec.Descriptor{},
+		store:     memory.New(),
+		labels:    newLabelStore(),
+		providers: newProviderStore(),
+		names:     newNameStore(),
 	}
 }
 
@@ -71,6 +96,7 @@ func (m *MemoryStore) Walk(ctx context.Context, fn ccontent.WalkFunc, filters ..
 
 func (m *MemoryStore) update(d digest.Digest, update map[string]string) (map[string]string, error) {
 	m.labels.l.Lock()
+	defer m.labels.l.Unlock()
 	labels, ok := m.labels.labels[d]
 	if !ok {
 		labels = map[string]string{}
@@ -83,9 +109,8 @@ func (m *MemoryStore) update(d digest.Digest, update map[string]string) (map[str
 		}
 	}
 	m.labels.labels[d] = labels
-	m.labels.l.Unlock()
 
-	return labels, nil
+	return copyLabels(labels), nil
 }
 
 // Delete is unimplemented as we don't use it in the flow of manifest-tool
@@ -98,16 +123,35 @@ func (m *MemoryStore) Info(ctx context.Context, d digest.Digest) (ccontent.Info,
 	m.labels.l.RLock()
 	info := ccontent.Info{
 		Digest: d,
-		Labels: m.labels.labels[d],
+		Labels: copyLabels(m.labels.labels[d]),
 	}
 	m.labels.l.RUnlock()
 	return info, nil
 }
 
-// ReaderAt returns a reader for a descriptor
+// copyLabels returns a copy of a label map so callers never share the stored map
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// ReaderAt returns a reader for a descriptor; if the content is not held in
+// memory, a provider registered for the digest via SetProvider is used instead
 func (m *MemoryStore) ReaderAt(ctx context.Context, desc ocispec.Descriptor) (ccontent.ReaderAt, error) {
 	rc, err := m.store.Fetch(context.Background(), desc)
 	if err != nil {
+		m.providers.l.RLock()
+		provider, ok := m.providers.providers[desc.Digest]
+		m.providers.l.RUnlock()
+		if ok {
+			return provider.ReaderAt(ctx, desc)
+		}
 		return nil, errdefs.ErrNotFound
 	}
 	defer rc.Close()
@@ -172,14 +216,26 @@ func (m *MemoryStore) Get(desc ocispec.Descriptor) (ocispec.Descriptor, []byte,
 // Set sets the content for a specific descriptor
 func (m *MemoryStore) Set(desc ocispec.Descriptor, content []byte) {
 	if name, ok := resolveName(desc); ok {
-		m.nameMap[name] = desc
+		m.names.l.Lock()
+		m.names.nameMap[name] = desc
+		m.names.l.Unlock()
 	}
 	_ = m.store.Push(context.Background(), desc, bytes.NewReader(content))
 }
 
+// SetProvider registers a content provider for a digest whose content is not
+// held in memory (e.g. layer blobs which must be read from another registry)
+func (m *MemoryStore) SetProvider(d digest.Digest, provider ccontent.Provider) {
+	m.providers.l.Lock()
+	m.providers.providers[d] = provider
+	m.providers.l.Unlock()
+}
+
 // GetByName retrieves a descriptor based on the associated name
 func (m *MemoryStore) GetByName(name string) (desc ocispec.Descriptor, content []byte, found bool) {
-	desc, found = m.nameMap[name]
+	m.names.l.RLock()
+	desc, found = m.names.nameMap[name]
+	m.names.l.RUnlock()
 	if !found {
 		return desc, nil, false
 	}
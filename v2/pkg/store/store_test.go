@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// TestMemoryStoreConcurrency exercises the store from many goroutines; run with -race
+func TestMemoryStoreConcurrency(t *testing.T) {
+	ms := NewMemoryStore()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// shared content and names are written by every goroutine, the rest by one only
+			for _, content := range []string{"shared", fmt.Sprintf("content-%d", i)} {
+				desc := ocispec.Descriptor{
+					MediaType: ocispec.MediaTypeImageManifest,
+					Digest:    digest.FromString(content),
+					Size:      int64(len(content)),
+					Annotations: map[string]string{
+						ocispec.AnnotationRefName: "name-" + content,
+					},
+				}
+				ms.Set(desc, []byte(content))
+				if _, b, ok := ms.Get(desc); !ok || string(b) != content {
+					t.Errorf("expected content %q, got %q", content, b)
+				}
+				if _, b, ok := ms.GetByName("name-" + content); !ok || string(b) != content {
+					t.Errorf("expected content %q by name, got %q", content, b)
+				}
+				info, err := ms.Update(ctx, ccontent.Info{
+					Digest: desc.Digest,
+					Labels: map[string]string{fmt.Sprintf("label-%d", i): "value"},
+				})
+				if err != nil {
+					t.Error(err)
+				}
+				// the returned labels must not be shared with the store
+				info.Labels["local"] = "value"
+				if info, err = ms.Info(ctx, desc.Digest); err != nil {
+					t.Error(err)
+				}
+				if info.Labels[fmt.Sprintf("label-%d", i)] != "value" {
+					t.Errorf("expected label-%d on %s", i, desc.Digest)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	info, err := ms.Info(ctx, digest.FromString("shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Labels) != 50 {
+		t.Fatalf("expected 50 labels on shared content, got %d", len(info.Labels))
+	}
+	if _, ok := info.Labels["local"]; ok {
+		t.Fatal("labels modified by a caller must not be stored")
+	}
+}
@@ -0,0 +1,8 @@
+package types
+
+// ArtifactFile is a file to be included as a layer of an artifact manifest
+// along with the media type to use for the layer
+type ArtifactFile struct {
+	Path      string
+	MediaType string
+}
@@ -0,0 +1,36 @@
+package types
+
+const (
+	// MediaTypeInTotoStatement is the media type of the in-toto statement layers of an attestation manifest
+	MediaTypeInTotoStatement = "application/vnd.in-toto+json"
+	// AnnotationInTotoPredicateType is the layer annotation holding the predicate type of an in-toto statement
+	AnnotationInTotoPredicateType = "in-toto.io/predicate-type"
+
+	// PredicateSLSAProvenanceV02 is the in-toto predicate type of SLSA v0.2 build provenance
+	PredicateSLSAProvenanceV02 = "https://slsa.dev/provenance/v0.2"
+	// PredicateSLSAProvenanceV1 is the in-toto predicate type of SLSA v1 build provenance
+	PredicateSLSAProvenanceV1 = "https://slsa.dev/provenance/v1"
+	// PredicateSPDX is the in-toto predicate type of an SPDX SBOM
+	PredicateSPDX = "https://spdx.dev/Document"
+)
+
+// AttestationFilter specifies which attestation manifests of the member images
+// are included in a manifest list/index: all of them (the zero value), none of
+// them, or only the in-toto statements with one of the listed predicate types
+type AttestationFilter struct {
+	Drop           bool
+	PredicateTypes []string
+}
+
+// Provenance holds the details of an SLSA build provenance statement
+type Provenance struct {
+	PredicateType string
+	BuilderID     string
+	Materials     []ProvenanceMaterial
+}
+
+// ProvenanceMaterial is an input (e.g. base image or source repository) of a build
+type ProvenanceMaterial struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
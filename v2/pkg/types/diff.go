@@ -0,0 +1,41 @@
+package types
+
+// ImageDiff is the result of comparing two images or manifest lists/indexes. Platforms
+// lists the comparison of each platform provided by both; platforms only provided by one
+// of them are listed separately. Identical is set when both have the same digest, and
+// Equivalent when no difference was found in any of the compared content (e.g. a Docker
+// manifest list and an OCI index for the same images). Attestation manifests are not compared.
+type ImageDiff struct {
+	Name1       string         `json:"name1"`
+	Name2       string         `json:"name2"`
+	Digest1     string         `json:"digest1"`
+	Digest2     string         `json:"digest2"`
+	Identical   bool           `json:"identical"`
+	Equivalent  bool           `json:"equivalent"`
+	Annotations []ValueChange  `json:"annotations,omitempty"`
+	OnlyIn1     []string       `json:"onlyIn1,omitempty"`
+	OnlyIn2     []string       `json:"onlyIn2,omitempty"`
+	Platforms   []PlatformDiff `json:"platforms"`
+}
+
+// PlatformDiff is the comparison of the image manifests of both sides for one platform.
+// Added layers are only in the second image, removed layers only in the first.
+type PlatformDiff struct {
+	Platform      string        `json:"platform"`
+	Digest1       string        `json:"digest1"`
+	Digest2       string        `json:"digest2"`
+	Identical     bool          `json:"identical"`
+	LayersAdded   []string      `json:"layersAdded,omitempty"`
+	LayersRemoved []string      `json:"layersRemoved,omitempty"`
+	LayersShared  []string      `json:"layersShared,omitempty"`
+	Config        []ValueChange `json:"config,omitempty"`
+	Annotations   []ValueChange `json:"annotations,omitempty"`
+}
+
+// ValueChange is a setting which differs between both sides; From is nil when the setting
+// is only present in the second image and To is nil when it is only present in the first
+type ValueChange struct {
+	Key  string  `json:"key"`
+	From *string `json:"from"`
+	To   *string `json:"to"`
+}
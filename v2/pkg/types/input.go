@@ -5,14 +5,17 @@ import ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 // YAMLInput contains the parsed yaml fields from the push
 // command of manifest-tool
 type YAMLInput struct {
-	Image     string
-	Tags      []string
-	Manifests []ManifestEntry
+	Image       string
+	Tags        []string
+	Annotations map[string]string
+	Manifests   []ManifestEntry
 }
 
 // ManifestEntry contains an image reference and it's corresponding OCI
-// platform definition (OS/Arch/Variant)
+// platform definition (OS/Arch/Variant), along with any annotations to
+// set on its descriptor in the manifest list/index
 type ManifestEntry struct {
-	Image    string
-	Platform ocispec.Platform
+	Image       string
+	Platform    ocispec.Platform
+	Annotations map[string]string
 }
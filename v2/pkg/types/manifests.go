@@ -2,6 +2,7 @@ package types
 
 import (
 	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
 	"github.com/docker/distribution/reference"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
@@ -20,20 +21,38 @@ const (
 
 // ManifestList represents the information necessary to assemble and
 // push the right data to a registry to form a manifestlist or OCI index
-// entry.
+// entry. Annotations are only supported by the OCI index format. Skipped
+// holds the input entries left out because their image could not be accessed.
+// Tracker, if set, is the push status tracker of the resolver.
 type ManifestList struct {
-	Name      string
-	Type      ManifestType
-	Reference reference.Named
-	Resolver  remotes.Resolver
-	Manifests []Manifest
+	Name        string
+	Type        ManifestType
+	Reference   reference.Named
+	Resolver    remotes.Resolver
+	Tracker     docker.StatusTracker
+	Annotations map[string]string
+	Manifests   []Manifest
+	Skipped     []ManifestEntry
 }
 
 // Manifest is an ocispec.Descriptor of media type manifest (OCI or Docker)
 // along with a boolean to help determine whether a reference to the manifest
 // must be pushed to the target (manifest list) repo location before finalizing
-// the manifest list push operation.
+// the manifest list push operation. Source is the registry image reference the
+// manifest was retrieved from, if any, and Layout the OCI image layout reference
+// (oci-layout:// or oci-archive://) it was read from otherwise.
 type Manifest struct {
 	Descriptor ocispec.Descriptor
 	PushRef    bool
+	Source     reference.Named
+	Layout     string
 }
+
+const (
+	// TransferCopied is the transfer of a component manifest with blobs uploaded to the target repository
+	TransferCopied = "copied"
+	// TransferMounted is the transfer of a component manifest with blobs mounted from another repository
+	TransferMounted = "mounted"
+	// TransferExisting is the transfer of a component manifest with all blobs already in the target repository
+	TransferExisting = "existing"
+)
@@ -0,0 +1,316 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes/docker"
+	hostsconfig "github.com/containerd/containerd/remotes/docker/config"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+)
+
+// MirrorOptions holds the locations of registry endpoint configurations. HostsDir is a
+// containerd hosts directory with a <host[:port]>/hosts.toml file per registry, and
+// RegistriesConf a containers-registries.conf(5) file in the version 2 format. A
+// hosts directory configuration takes precedence over registries.conf for a registry.
+type MirrorOptions struct {
+	HostsDir       string
+	RegistriesConf string
+}
+
+var (
+	mirrorOptionsLock sync.RWMutex
+	mirrorOptions     MirrorOptions
+	registriesConfig  *registriesConf
+)
+
+// SetMirrorOptions sets the registry endpoint configuration used by registry hosts
+// created afterwards. The registries.conf file, if any, is read and validated here.
+func SetMirrorOptions(opts MirrorOptions) error {
+	if opts.HostsDir != "" {
+		if _, err := os.Stat(opts.HostsDir); err != nil {
+			return fmt.Errorf("unable to use hosts directory %s: %v", opts.HostsDir, err)
+		}
+	}
+	var conf *registriesConf
+	if opts.RegistriesConf != "" {
+		var err error
+		conf, err = loadRegistriesConf(opts.RegistriesConf)
+		if err != nil {
+			return err
+		}
+	}
+	mirrorOptionsLock.Lock()
+	mirrorOptions = opts
+	registriesConfig = conf
+	mirrorOptionsLock.Unlock()
+	return nil
+}
+
+// registriesConf is the subset of containers-registries.conf(5) used for endpoint selection
+type registriesConf struct {
+	Registries []registriesConfRegistry `toml:"registry"`
+}
+
+type registriesConfRegistry struct {
+	Prefix             string                 `toml:"prefix"`
+	Location           string                 `toml:"location"`
+	Insecure           bool                   `toml:"insecure"`
+	Blocked            bool                   `toml:"blocked"`
+	MirrorByDigestOnly bool                   `toml:"mirror-by-digest-only"`
+	Mirrors            []registriesConfMirror `toml:"mirror"`
+}
+
+type registriesConfMirror struct {
+	Location       string `toml:"location"`
+	Insecure       bool   `toml:"insecure"`
+	PullFromMirror string `toml:"pull-from-mirror"`
+}
+
+func loadRegistriesConf(path string) (*registriesConf, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registries configuration %s: %v", path, err)
+	}
+	var conf registriesConf
+	if err := toml.Unmarshal(b, &conf); err != nil {
+		return nil, fmt.Errorf("unable to parse registries configuration %s: %v", path, err)
+	}
+	registries := conf.Registries[:0]
+	for _, reg := range conf.Registries {
+		if reg.Prefix == "" {
+			reg.Prefix = reg.Location
+		}
+		if reg.Location == "" {
+			reg.Location = reg.Prefix
+		}
+		if reg.Prefix == "" {
+			return nil, fmt.Errorf("registry entry without prefix or location in %s", path)
+		}
+		if strings.Contains(reg.Prefix, "/") {
+			// the resolver selects endpoints per registry host, not per repository
+			logrus.Warnf("ignoring registry %q in %s: only registry host prefixes are supported", reg.Prefix, path)
+			continue
+		}
+		for _, m := range reg.Mirrors {
+			if m.Location == "" {
+				return nil, fmt.Errorf("mirror without location for registry %q in %s", reg.Prefix, path)
+			}
+			switch m.PullFromMirror {
+			case "", "all", "digest-only":
+			case "tag-only":
+				return nil, fmt.Errorf("mirror %s for registry %q in %s: pull-from-mirror = \"tag-only\" is not supported", m.Location, reg.Prefix, path)
+			default:
+				return nil, fmt.Errorf("mirror %s for registry %q in %s: invalid pull-from-mirror value %q", m.Location, reg.Prefix, path, m.PullFromMirror)
+			}
+		}
+		registries = append(registries, reg)
+	}
+	conf.Registries = registries
+	return &conf, nil
+}
+
+// find returns the registry entry for a registry hostname: an exact prefix match, or
+// else the longest matching "*.domain" wildcard prefix
+func (c *registriesConf) find(hostname string) (registriesConfRegistry, bool) {
+	var (
+		match registriesConfRegistry
+		found bool
+	)
+	for _, reg := range c.Registries {
+		if reg.Prefix == hostname {
+			return reg, true
+		}
+		if strings.HasPrefix(reg.Prefix, "*.") && strings.HasSuffix(hostname, reg.Prefix[1:]) &&
+			(!found || len(reg.Prefix) > len(match.Prefix)) {
+			match, found = reg, true
+		}
+	}
+	return match, found
+}
+
+// registryEndpoints returns the ordered endpoints the resolver uses for a registry: the
+// configured mirrors, tried in order for reads, followed by the host receiving pushes.
+// Without a configuration for the registry, server is the only endpoint. tlsConf is the
+// TLS configuration of the registry and mirrorTLS the default TLS configuration of the
+// endpoints configured in the hosts directory. When clientCert is set, the host receiving
+// pushes is presented the global client certificate, but the mirrors never are.
+func registryEndpoints(refHostname string, server docker.RegistryHost, tlsConf, mirrorTLS *tls.Config, insecure, plainHTTP, pushOp, clientCert bool) ([]docker.RegistryHost, error) {
+	mirrorOptionsLock.RLock()
+	opts := mirrorOptions
+	conf := registriesConfig
+	mirrorOptionsLock.RUnlock()
+
+	var (
+		hosts []docker.RegistryHost
+		err   error
+	)
+	if opts.HostsDir != "" {
+		var clientCerts []tls.Certificate
+		if clientCert && tlsConf != nil {
+			clientCerts = tlsConf.Certificates
+		}
+		hosts, err = hostsDirEndpoints(opts.HostsDir, refHostname, mirrorTLS, clientCerts, plainHTTP)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hosts == nil && conf != nil {
+		if reg, ok := conf.find(refHostname); ok {
+			if reg.Blocked {
+				return nil, fmt.Errorf("registry %s is blocked in %s", refHostname, opts.RegistriesConf)
+			}
+			hosts, err = registriesConfEndpoints(reg, server, insecure, clientCert)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if hosts == nil {
+		return []docker.RegistryHost{server}, nil
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no endpoints configured for registry %s", refHostname)
+	}
+
+	// mirrors are only read from; pushes always go to the last, canonical endpoint
+	for i := range hosts[:len(hosts)-1] {
+		hosts[i].Capabilities &^= docker.HostCapabilityPush
+	}
+	if !pushOp {
+		hosts[len(hosts)-1].Capabilities &^= docker.HostCapabilityPush
+	}
+	for _, host := range hosts {
+		logrus.Debugf("registry %s endpoint: %s://%s%s", refHostname, host.Scheme, host.Host, host.Path)
+	}
+	return hosts, nil
+}
+
+// hostsDirEndpoints returns the endpoints configured in the hosts.toml file of a containerd
+// hosts directory, or nil if the directory has no configuration for the registry. The last,
+// canonical endpoint is presented the client certificates unless hosts.toml configures its own.
+func hostsDirEndpoints(root, refHostname string, tlsConf *tls.Config, clientCerts []tls.Certificate, plainHTTP bool) ([]docker.RegistryHost, error) {
+	dir, err := hostsconfig.HostDirFromRoot(root)(refHostname)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to find hosts configuration for %s in %s: %v", refHostname, root, err)
+	}
+	scheme := "https"
+	if plainHTTP {
+		scheme = "http"
+	}
+	// the TLS configuration of each client created for the endpoints
+	clientTLSConfigs := map[*http.Client]*tls.Config{}
+	hostsFunc := hostsconfig.ConfigureHosts(context.Background(), hostsconfig.HostOptions{
+		HostDir: func(string) (string, error) {
+			return dir, nil
+		},
+		DefaultTLS:    tlsConf,
+		DefaultScheme: scheme,
+		// replace containerd's default transport with one using our transport settings
+		UpdateClient: func(client *http.Client) error {
+			var clientTLS *tls.Config
+			if transport, ok := client.Transport.(*http.Transport); ok {
+				clientTLS = transport.TLSClientConfig
+			}
+			clientTLSConfigs[client] = clientTLS
+			client.Transport = newClient(clientTLS).Transport
+			return nil
+		},
+	})
+	hosts, err := hostsFunc(refHostname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load hosts configuration for %s from %s: %v", refHostname, dir, err)
+	}
+	if hosts == nil {
+		hosts = []docker.RegistryHost{}
+	}
+	if len(hosts) > 0 && len(clientCerts) > 0 {
+		server := &hosts[len(hosts)-1]
+		serverTLS := clientTLSConfigs[server.Client]
+		if serverTLS == nil || len(serverTLS.Certificates) == 0 {
+			if serverTLS == nil {
+				serverTLS = &tls.Config{}
+			} else {
+				serverTLS = serverTLS.Clone()
+			}
+			serverTLS.Certificates = clientCerts
+			// the client may be shared with mirrors, so the server gets a client of its own
+			client := newClient(serverTLS)
+			if _, ok := server.Client.Transport.(docker.HTTPFallback); ok {
+				client.Transport = docker.HTTPFallback{RoundTripper: client.Transport}
+			}
+			server.Client = client
+		}
+	}
+	return hosts, nil
+}
+
+// registriesConfEndpoints returns the endpoints of a registries.conf registry entry: its
+// mirrors followed by its location, which may rewrite the registry host and add a path prefix.
+// When clientCert is set, a rewritten location is presented the global client certificate.
+func registriesConfEndpoints(reg registriesConfRegistry, server docker.RegistryHost, insecure, clientCert bool) ([]docker.RegistryHost, error) {
+	var hosts []docker.RegistryHost
+	for _, m := range reg.Mirrors {
+		host, err := newEndpoint(m.Location, insecure || m.Insecure, false)
+		if err != nil {
+			return nil, err
+		}
+		host.Capabilities = docker.HostCapabilityPull | docker.HostCapabilityResolve
+		if reg.MirrorByDigestOnly || m.PullFromMirror == "digest-only" {
+			// without the resolve capability the mirror is only used for digest references
+			host.Capabilities = docker.HostCapabilityPull
+		}
+		hosts = append(hosts, host)
+	}
+	if reg.Location != reg.Prefix || reg.Insecure {
+		host, err := newEndpoint(reg.Location, insecure || reg.Insecure, clientCert)
+		if err != nil {
+			return nil, err
+		}
+		if server.Scheme == "http" {
+			host.Scheme = "http"
+		}
+		host.Capabilities = server.Capabilities
+		server = host
+	}
+	return append(hosts, server), nil
+}
+
+// newEndpoint returns a registry endpoint for a "host[:port][/path]" location. The path
+// is used as a prefix of all repository names on the endpoint. An insecure endpoint skips
+// TLS verification and falls back to plain HTTP. The certificates configured for the
+// endpoint's host in the certificates directories are used, and the global client
+// certificate when clientCert is set.
+func newEndpoint(location string, insecure, clientCert bool) (docker.RegistryHost, error) {
+	hostname, path := location, ""
+	if i := strings.Index(location, "/"); i >= 0 {
+		hostname, path = location[:i], strings.TrimSuffix(location[i:], "/")
+	}
+	tlsConf, err := tlsConfig(hostname, insecure, clientCert)
+	if err != nil {
+		return docker.RegistryHost{}, fmt.Errorf("error creating TLS configuration for %s: %v", hostname, err)
+	}
+	if hostname == "docker.io" {
+		hostname = "registry-1.docker.io"
+	}
+	client := newClient(tlsConf)
+	if insecure {
+		client.Transport = docker.HTTPFallback{RoundTripper: client.Transport}
+	}
+	return docker.RegistryHost{
+		Host:   hostname,
+		Scheme: "https",
+		Path:   "/v2" + path,
+		Client: client,
+	}, nil
+}
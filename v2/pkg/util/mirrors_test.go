@@ -0,0 +1,200 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+)
+
+func TestRegistriesConfEndpoints(t *testing.T) {
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	conf := `
+[[registry]]
+prefix = "docker.io"
+[[registry.mirror]]
+location = "mirror.example.com/dockerhub"
+[[registry.mirror]]
+location = "digests.example.com"
+pull-from-mirror = "digest-only"
+
+[[registry]]
+prefix = "*.example.org"
+location = "registry.example.net/org"
+
+[[registry]]
+prefix = "quay.io/namespace"
+blocked = true
+`
+	if err := os.WriteFile(confPath, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = SetMirrorOptions(MirrorOptions{})
+	}()
+	if err := SetMirrorOptions(MirrorOptions{RegistriesConf: confPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := reference.ParseNormalizedNamed("alpine:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRegistryHost(ref, "user", "secret", false, false, "", true); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := getHosts("docker.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		host, path string
+		caps       docker.HostCapabilities
+	}{
+		{"mirror.example.com", "/v2/dockerhub", docker.HostCapabilityPull | docker.HostCapabilityResolve},
+		{"digests.example.com", "/v2", docker.HostCapabilityPull},
+		{"registry-1.docker.io", "/v2", docker.HostCapabilityPull | docker.HostCapabilityResolve | docker.HostCapabilityPush},
+	}
+	if len(hosts) != len(expected) {
+		t.Fatalf("expected %d endpoints, got %d", len(expected), len(hosts))
+	}
+	for i, e := range expected {
+		if hosts[i].Host != e.host || hosts[i].Path != e.path || hosts[i].Capabilities != e.caps {
+			t.Errorf("endpoint %d: expected %s%s (%d), got %s%s (%d)", i, e.host, e.path, e.caps, hosts[i].Host, hosts[i].Path, hosts[i].Capabilities)
+		}
+	}
+	host, err := GetRegistryHost("docker.io")
+	if err != nil || host.Host != "registry-1.docker.io" {
+		t.Fatalf("expected the registry itself for requests outside the resolver, got %q (err: %v)", host.Host, err)
+	}
+
+	// a wildcard prefix rewrites the registry location
+	ref, err = reference.ParseNormalizedNamed("registry.example.org/image:tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRegistryHost(ref, "", "", false, false, "", false); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err = getHosts("registry.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].Host != "registry.example.net" || hosts[0].Path != "/v2/org" || hosts[0].Capabilities.Has(docker.HostCapabilityPush) {
+		t.Fatalf("unexpected endpoints for wildcard registry: %+v", hosts)
+	}
+}
+
+func TestRegistriesConfInsecure(t *testing.T) {
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	conf := `
+[[registry]]
+prefix = "registry.example.com"
+location = "registry.example.net"
+[[registry.mirror]]
+location = "mirror.example.com"
+[[registry.mirror]]
+location = "insecure-mirror.example.com"
+insecure = true
+`
+	if err := os.WriteFile(confPath, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = SetMirrorOptions(MirrorOptions{})
+	}()
+	if err := SetMirrorOptions(MirrorOptions{RegistriesConf: confPath}); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.ParseNormalizedNamed("registry.example.com/image:tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the global insecure flag applies to every endpoint, the registries.conf setting only to its own
+	for _, insecure := range []bool{false, true} {
+		if err := CreateRegistryHost(ref, "", "", insecure, false, "", true); err != nil {
+			t.Fatal(err)
+		}
+		hosts, err := getHosts("registry.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []bool{insecure, true, insecure}
+		if len(hosts) != len(expected) {
+			t.Fatalf("expected %d endpoints, got %d", len(expected), len(hosts))
+		}
+		for i, host := range hosts {
+			_, fallback := host.Client.Transport.(docker.HTTPFallback)
+			if fallback != expected[i] {
+				t.Errorf("insecure %v: expected endpoint %s insecure %v", insecure, host.Host, expected[i])
+			}
+		}
+	}
+}
+
+func TestHostsDirEndpoints(t *testing.T) {
+	hostsDir := t.TempDir()
+	hostDir := filepath.Join(hostsDir, "myregistry:5000")
+	if err := os.Mkdir(hostDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	hostsToml := `
+server = "https://myregistry:5000"
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve", "push"]
+`
+	if err := os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(hostsToml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = SetMirrorOptions(MirrorOptions{})
+	}()
+	if err := SetMirrorOptions(MirrorOptions{HostsDir: hostsDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := reference.ParseNormalizedNamed("myregistry:5000/image:tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRegistryHost(ref, "", "", false, false, "", true); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := getHosts("myregistry:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", len(hosts))
+	}
+	if hosts[0].Host != "mirror.example.com" || hosts[0].Capabilities.Has(docker.HostCapabilityPush) {
+		t.Errorf("expected a pull-only mirror, got %s (%d)", hosts[0].Host, hosts[0].Capabilities)
+	}
+	if hosts[1].Host != "myregistry:5000" || !hosts[1].Capabilities.Has(docker.HostCapabilityPush) {
+		t.Errorf("expected pushes to go to the registry, got %s (%d)", hosts[1].Host, hosts[1].Capabilities)
+	}
+}
+
+func TestRegistriesConfBlocked(t *testing.T) {
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	if err := os.WriteFile(confPath, []byte("[[registry]]\nlocation = \"blocked.example.com\"\nblocked = true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = SetMirrorOptions(MirrorOptions{})
+	}()
+	if err := SetMirrorOptions(MirrorOptions{RegistriesConf: confPath}); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.ParseNormalizedNamed("blocked.example.com/image:tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRegistryHost(ref, "", "", false, false, "", false); err == nil {
+		t.Fatal("expected error for blocked registry")
+	}
+}
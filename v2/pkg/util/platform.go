@@ -0,0 +1,82 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParsePlatform parses a platform specifier of the form os[(osversion)]/arch[/variant]
+// into an OCI platform object; the optional OS version is used to select a specific
+// Windows release, e.g. "windows(10.0.17763)/amd64"
+func ParsePlatform(specifier string) (ocispec.Platform, error) {
+	var osVersion string
+	parts := strings.Split(specifier, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return ocispec.Platform{}, fmt.Errorf("platform %q must be of the form os/arch or os/arch/variant", specifier)
+	}
+	if i := strings.IndexRune(parts[0], '('); i >= 0 {
+		if !strings.HasSuffix(parts[0], ")") {
+			return ocispec.Platform{}, fmt.Errorf("platform %q has an invalid OS version specification", specifier)
+		}
+		osVersion = parts[0][i+1 : len(parts[0])-1]
+		parts[0] = parts[0][:i]
+	}
+	platform, err := platforms.Parse(strings.Join(parts, "/"))
+	if err != nil {
+		return ocispec.Platform{}, err
+	}
+	platform.OSVersion = osVersion
+	return platform, nil
+}
+
+// MatchPlatform selects the descriptor a container runtime would pull for the requested
+// platform from a list of manifest descriptors (e.g. the entries of an index). Compatible
+// variants are accepted and ranked below an exact match, and when the requested platform
+// specifies an OS version only entries for the same Windows build are considered, with an
+// exact OS version match preferred.
+func MatchPlatform(platform ocispec.Platform, descs []ocispec.Descriptor) (ocispec.Descriptor, bool) {
+	requested := platform
+	requested.OSVersion = ""
+	matcher := platforms.Only(requested)
+
+	var candidates []ocispec.Descriptor
+	for _, desc := range descs {
+		if desc.Platform == nil || !matcher.Match(*desc.Platform) {
+			continue
+		}
+		if platform.OSVersion != "" && osBuild(desc.Platform.OSVersion) != osBuild(platform.OSVersion) {
+			continue
+		}
+		candidates = append(candidates, desc)
+	}
+	if len(candidates) == 0 {
+		return ocispec.Descriptor{}, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := *candidates[i].Platform, *candidates[j].Platform
+		if platform.OSVersion != "" && pi.OSVersion != pj.OSVersion {
+			if pi.OSVersion == platform.OSVersion {
+				return true
+			}
+			if pj.OSVersion == platform.OSVersion {
+				return false
+			}
+		}
+		return matcher.Less(pi, pj)
+	})
+	return candidates[0], true
+}
+
+// osBuild returns the "major.minor.build" prefix of a Windows OS version string, which
+// must match between the host and an image for the image to be usable on that host
+func osBuild(osVersion string) string {
+	parts := strings.Split(osVersion, ".")
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParsePlatform(t *testing.T) {
+	var tests = []struct {
+		specifier string
+		expected  ocispec.Platform
+	}{
+		{specifier: "linux/amd64", expected: ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		{specifier: "linux/arm/v7", expected: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{specifier: "linux/aarch64", expected: ocispec.Platform{OS: "linux", Architecture: "arm64"}},
+		{specifier: "windows(10.0.17763)/amd64", expected: ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"}},
+	}
+	for _, test := range tests {
+		p, err := ParsePlatform(test.specifier)
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", test.specifier, err)
+			continue
+		}
+		if p.OS != test.expected.OS || p.Architecture != test.expected.Architecture ||
+			p.Variant != test.expected.Variant || p.OSVersion != test.expected.OSVersion {
+			t.Errorf("parsing %s: expected %+v, got %+v", test.specifier, test.expected, p)
+		}
+	}
+
+	for _, specifier := range []string{"linux", "linux/amd64/v2/extra", "windows(10.0/amd64"} {
+		if _, err := ParsePlatform(specifier); err == nil {
+			t.Errorf("expected error parsing invalid platform %s", specifier)
+		}
+	}
+}
+
+func TestMatchPlatform(t *testing.T) {
+	descs := []ocispec.Descriptor{
+		{Digest: digest.FromString("amd64"), Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		{Digest: digest.FromString("armv6"), Platform: &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}},
+		{Digest: digest.FromString("armv7"), Platform: &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{Digest: digest.FromString("ltsc2019"), Platform: &ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}},
+		{Digest: digest.FromString("ltsc2022"), Platform: &ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.1000"}},
+		{Digest: digest.FromString("attestation"), Platform: &ocispec.Platform{OS: "unknown", Architecture: "unknown"}},
+	}
+	var tests = []struct {
+		specifier string
+		expected  string
+		found     bool
+	}{
+		{specifier: "linux/amd64", expected: "amd64", found: true},
+		{specifier: "linux/arm/v7", expected: "armv7", found: true},
+		{specifier: "linux/arm/v6", expected: "armv6", found: true},
+		{specifier: "linux/arm64", expected: "armv7", found: true},
+		{specifier: "linux/s390x", found: false},
+		{specifier: "windows/amd64", expected: "ltsc2019", found: true},
+		{specifier: "windows(10.0.20348)/amd64", expected: "ltsc2022", found: true},
+		{specifier: "windows(10.0.17763.2300)/amd64", expected: "ltsc2019", found: true},
+		{specifier: "windows(10.0.14393)/amd64", found: false},
+	}
+	for _, test := range tests {
+		p, err := ParsePlatform(test.specifier)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %v", test.specifier, err)
+		}
+		desc, found := MatchPlatform(p, descs)
+		if found != test.found {
+			t.Errorf("%s: expected found=%v, got %v", test.specifier, test.found, found)
+			continue
+		}
+		if found && desc.Digest != digest.FromString(test.expected) {
+			t.Errorf("%s: expected %s entry, got %s", test.specifier, test.expected, desc.Digest)
+		}
+	}
+}
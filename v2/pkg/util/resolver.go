@@ -1,12 +1,11 @@
 package util
 
 import (
-	"crypto/tls"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
@@ -21,16 +20,49 @@ import (
 var (
 	configDir     = os.Getenv("DOCKER_CONFIG")
 	configFileDir = ".docker"
-	registryHost  docker.RegistryHost
+	registryHosts = newHostStore()
 )
 
+// hostStore holds the registry host configuration for every registry
+// hostname the resolver may be asked to talk to
+type hostStore struct {
+	l     sync.RWMutex
+	hosts map[string][]docker.RegistryHost
+}
+
+func newHostStore() *hostStore {
+	return &hostStore{
+		hosts: map[string][]docker.RegistryHost{},
+	}
+}
+
+// CreateRegistryHost configures the registry host used for the registry of the
+// provided image reference. Each registry hostname keeps its own configuration,
+// so calling this for references on different registries allows a single resolver
+// to work across all of them; calling it again for the same registry replaces the
+// prior configuration for that hostname. Mirrors configured with SetMirrorOptions
+// are used for reads, while pushes always go to the registry itself. The registry is
+// presented the global client certificate set with SetTLSOptions.
 func CreateRegistryHost(imageRef reference.Named, username, password string, insecure, plainHTTP bool, dockerConfigPath string, pushOp bool) error {
+	return createRegistryHost(imageRef, username, password, insecure, plainHTTP, dockerConfigPath, pushOp, true)
+}
+
+// CreateSourceRegistryHost configures the registry host for a registry which images are only
+// read from, such as the registry of a member image. Command line credentials and the global
+// client certificate are meant for the target registry, so only the Docker config credentials
+// and the certificates directories are used for this registry.
+func CreateSourceRegistryHost(imageRef reference.Named, insecure, plainHTTP bool, dockerConfigPath string) error {
+	return createRegistryHost(imageRef, "", "", insecure, plainHTTP, dockerConfigPath, false, false)
+}
 
-	hostname, _ := splitHostname(imageRef.String())
+func createRegistryHost(imageRef reference.Named, username, password string, insecure, plainHTTP bool, dockerConfigPath string, pushOp, clientCert bool) error {
+
+	refHostname, _ := splitHostname(imageRef.String())
+	hostname := refHostname
 	if hostname == "docker.io" {
 		hostname = "registry-1.docker.io"
 	}
-	registryHost = docker.RegistryHost{
+	registryHost := docker.RegistryHost{
 		Host:         hostname,
 		Scheme:       "https",
 		Path:         "/v2",
@@ -40,25 +72,27 @@ func CreateRegistryHost(imageRef reference.Named, username, password string, ins
 		registryHost.Capabilities |= docker.HostCapabilityPush
 	}
 
-	client := http.DefaultClient
-
-	if insecure {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
+	// each registry host gets a dedicated client; the process-wide default client is never modified
+	tlsConf, err := tlsConfig(refHostname, insecure, clientCert)
+	if err != nil {
+		return fmt.Errorf("error creating TLS configuration for %s: %v", refHostname, err)
+	}
+	registryHost.Client = newClient(tlsConf)
+	// mirrors configured in a hosts directory default to the settings without the global
+	// client certificate, as they may be run by third parties; the canonical endpoint
+	// receiving pushes is still presented the client certificate
+	defaultTLS := tlsConf
+	if clientCert {
+		if defaultTLS, err = tlsConfig(refHostname, insecure, false); err != nil {
+			return fmt.Errorf("error creating TLS configuration for %s: %v", refHostname, err)
 		}
 	}
-	registryHost.Client = client
 
 	if plainHTTP {
 		registryHost.Scheme = "http"
 	}
 
-	credFunc := func(hostName string) (string, string, error) {
-		if username != "" || password != "" {
-			return username, password, nil
-		}
+	configCreds := func(hostName string) (string, string, error) {
 		var (
 			err error
 			cfg *configfile.ConfigFile
@@ -97,21 +131,75 @@ func CreateRegistryHost(imageRef reference.Named, username, password string, ins
 		return auth.Username, auth.Password, nil
 
 	}
-	registryHost.Authorizer = docker.NewDockerAuthorizer(docker.WithAuthCreds(credFunc))
+	credFunc := func(hostName string) (string, string, error) {
+		if username != "" || password != "" {
+			return username, password, nil
+		}
+		return configCreds(hostName)
+	}
+
+	hosts, err := registryEndpoints(refHostname, registryHost, tlsConf, defaultTLS, insecure, plainHTTP, pushOp, clientCert)
+	if err != nil {
+		return err
+	}
+	for i := range hosts {
+		creds := credFunc
+		if i < len(hosts)-1 {
+			// credentials given on the command line are only sent to the registry, not to its mirrors
+			creds = configCreds
+		}
+		hosts[i].Authorizer = docker.NewDockerAuthorizer(docker.WithAuthClient(hosts[i].Client), docker.WithAuthCreds(creds))
+	}
+
+	registryHosts.l.Lock()
+	for _, prior := range registryHosts.hosts[refHostname] {
+		if prior.Client != nil {
+			// release the pooled connections of the replaced configuration
+			prior.Client.CloseIdleConnections()
+		}
+	}
+	registryHosts.hosts[refHostname] = hosts
+	registryHosts.l.Unlock()
 
 	return nil
 }
 
 func GetResolver() remotes.Resolver {
+	resolver, _ := GetTrackingResolver()
+	return resolver
+}
 
+// GetTrackingResolver returns a resolver along with the status tracker of its pushes, which
+// records for each pushed blob whether it already existed, was mounted from another
+// repository or was uploaded
+func GetTrackingResolver() (remotes.Resolver, docker.StatusTracker) {
+	tracker := docker.NewInMemoryTracker()
 	opts := docker.ResolverOptions{
-		Hosts: getHosts,
+		Hosts:   getHosts,
+		Tracker: tracker,
 	}
-	return docker.NewResolver(opts)
+	return docker.NewResolver(opts), tracker
 }
 
 func getHosts(name string) ([]docker.RegistryHost, error) {
-	return []docker.RegistryHost{registryHost}, nil
+	registryHosts.l.RLock()
+	defer registryHosts.l.RUnlock()
+	hosts, ok := registryHosts.hosts[name]
+	if !ok {
+		return nil, fmt.Errorf("no registry host configuration found for registry %q", name)
+	}
+	return hosts, nil
+}
+
+// GetRegistryHost returns the registry host configuration for a registry hostname, as
+// found in an image reference, for requests the resolver has no support for. When
+// mirrors are configured, this is the registry itself rather than one of its mirrors.
+func GetRegistryHost(name string) (docker.RegistryHost, error) {
+	hosts, err := getHosts(name)
+	if err != nil {
+		return docker.RegistryHost{}, err
+	}
+	return hosts[len(hosts)-1], nil
 }
 
 // resolveHostname resolves Docker specific hostnames
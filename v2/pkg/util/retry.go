@@ -0,0 +1,208 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	jitterLock sync.Mutex
+	jitter     = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// retryTransport retries registry requests failing with a transient error: a 429 or 5xx
+// response, or a connection reset by the registry. Retries are delayed with an exponential
+// backoff with jitter, or as long as the registry asks in a Retry-After header. Requests with
+// a body that cannot be replayed, such as streamed blob uploads, are not retried.
+type retryTransport struct {
+	transport  *http.Transport
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.transport.RoundTrip(req)
+		if err == nil {
+			recordRateLimit(req.URL.Host, resp.Header)
+		}
+		reason := retryReason(resp, err)
+		if reason == "" || attempt >= t.maxRetries || req.Context().Err() != nil {
+			return resp, err
+		}
+		delay := t.delay(attempt, resp)
+		next := req
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			next = req.Clone(req.Context())
+			next.Body = body
+		}
+		if resp != nil {
+			// drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		logrus.Warnf("%s %s: %s; retrying in %s (retry %d of %d)", req.Method, req.URL.Redacted(), reason, delay.Round(time.Millisecond), attempt+1, t.maxRetries)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			if next.Body != nil {
+				next.Body.Close()
+			}
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		req = next
+	}
+}
+
+// CloseIdleConnections closes the idle connections of the underlying transport
+func (t *retryTransport) CloseIdleConnections() {
+	t.transport.CloseIdleConnections()
+}
+
+// delay returns how long to wait before retrying after the given attempt; a wait requested
+// by the registry with Retry-After is used as is unless it exceeds the maximum backoff, in
+// which case the maximum backoff is waited instead
+func (t *retryTransport) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if retryAfter > t.maxBackoff {
+				logrus.Debugf("registry asks to wait %s before retrying; waiting the maximum backoff of %s", retryAfter, t.maxBackoff)
+				return t.maxBackoff
+			}
+			return retryAfter
+		}
+	}
+	backoff := t.backoff
+	for i := 0; i < attempt && backoff < t.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > t.maxBackoff {
+		backoff = t.maxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	// wait between half and all of the backoff so concurrent clients spread their retries
+	jitterLock.Lock()
+	defer jitterLock.Unlock()
+	return backoff/2 + time.Duration(jitter.Int63n(int64(backoff/2)+1))
+}
+
+// retryReason describes the transient failure of a request, or returns an empty string if
+// the request should not be retried
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return err.Error()
+		}
+		return ""
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+	case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented && resp.StatusCode != http.StatusHTTPVersionNotSupported:
+	default:
+		return ""
+	}
+	return resp.Status
+}
+
+// parseRetryAfter parses a Retry-After header value given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// RateLimit is the pull rate limit status last reported by a registry, such as Docker Hub,
+// in its ratelimit-limit and ratelimit-remaining response headers. Window is the duration
+// of the rate limit window in seconds, when reported.
+type RateLimit struct {
+	Host      string `json:"host"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Window    int    `json:"window,omitempty"`
+}
+
+var (
+	rateLimitsLock sync.Mutex
+	rateLimits     = map[string]RateLimit{}
+)
+
+// RateLimits returns the rate limit status reported by each registry host so far
+func RateLimits() []RateLimit {
+	rateLimitsLock.Lock()
+	defer rateLimitsLock.Unlock()
+	limits := make([]RateLimit, 0, len(rateLimits))
+	for _, limit := range rateLimits {
+		limits = append(limits, limit)
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Host < limits[j].Host
+	})
+	return limits
+}
+
+func recordRateLimit(host string, header http.Header) {
+	remaining, _, ok := parseRateLimit(header.Get("ratelimit-remaining"))
+	if !ok {
+		return
+	}
+	limit, window, _ := parseRateLimit(header.Get("ratelimit-limit"))
+	logrus.Debugf("registry %s rate limit: %d of %d requests remaining (window: %ds)", host, remaining, limit, window)
+
+	rateLimitsLock.Lock()
+	rateLimits[host] = RateLimit{
+		Host:      host,
+		Limit:     limit,
+		Remaining: remaining,
+		Window:    window,
+	}
+	rateLimitsLock.Unlock()
+}
+
+// parseRateLimit parses a rate limit header value of the form "100;w=21600"
+func parseRateLimit(value string) (int, int, bool) {
+	count, params, _ := strings.Cut(value, ";")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil {
+		return 0, 0, false
+	}
+	var window int
+	for _, param := range strings.Split(params, ";") {
+		if key, val, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "w" {
+			window, _ = strconv.Atoi(val)
+		}
+	}
+	return n, window, true
+}
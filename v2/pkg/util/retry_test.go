@@ -0,0 +1,144 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var (
+		requests int
+		bodies   []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Header().Set("ratelimit-limit", "100;w=21600")
+		w.Header().Set("ratelimit-remaining", "76;w=21600")
+		switch requests {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &retryTransport{
+			transport:  &http.Transport{},
+			maxRetries: 3,
+			backoff:    time.Millisecond,
+			maxBackoff: 10 * time.Millisecond,
+		},
+	}
+	resp, err := client.Post(server.URL, "application/json", bytes.NewReader([]byte("manifest")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || requests != 3 {
+		t.Fatalf("expected success after 3 requests, got %s after %d", resp.Status, requests)
+	}
+	for i, body := range bodies {
+		if body != "manifest" {
+			t.Errorf("request %d: expected the request body to be replayed, got %q", i+1, body)
+		}
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	var found bool
+	for _, limit := range RateLimits() {
+		if limit.Host == host {
+			found = true
+			if limit.Limit != 100 || limit.Remaining != 76 || limit.Window != 21600 {
+				t.Errorf("unexpected rate limit %+v", limit)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected rate limit for %s", host)
+	}
+}
+
+func TestRetryTransportLimits(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/later" {
+			w.Header().Set("Retry-After", "3600")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &retryTransport{
+			transport:  &http.Transport{},
+			maxRetries: 2,
+			backoff:    time.Millisecond,
+			maxBackoff: 10 * time.Millisecond,
+		},
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || requests != 3 {
+		t.Fatalf("expected the last failure after 3 requests, got %s after %d", resp.Status, requests)
+	}
+
+	// a Retry-After longer than the maximum backoff is capped at the maximum backoff
+	requests = 0
+	start := time.Now()
+	resp, err = client.Get(server.URL + "/later")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected retries after the maximum backoff, took %s", elapsed)
+	}
+
+	// streamed bodies cannot be replayed
+	requests = 0
+	req, err := http.NewRequest(http.MethodPut, server.URL, io.NopCloser(strings.NewReader("blob")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if requests != 1 {
+		t.Fatalf("expected no retry, got %d requests", requests)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	for value, expected := range map[string][3]int{
+		"100;w=21600": {100, 21600, 1},
+		"76":          {76, 0, 1},
+		"":            {0, 0, 0},
+		"none":        {0, 0, 0},
+	} {
+		n, window, ok := parseRateLimit(value)
+		if n != expected[0] || window != expected[1] || ok != (expected[2] == 1) {
+			t.Errorf("%q: got %d, %d, %v", value, n, window, ok)
+		}
+	}
+}
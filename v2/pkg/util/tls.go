@@ -0,0 +1,119 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultCertsDirs are the Docker and containerd directories holding per-registry
+// certificates in <dir>/<host[:port]>/ subdirectories
+var DefaultCertsDirs = []string{"/etc/docker/certs.d", "/etc/containerd/certs.d"}
+
+// TLSOptions holds the TLS settings used for registry connections. CACert is a PEM bundle
+// of additional CAs trusted for all registries. ClientCert/ClientKey is a client certificate
+// for mutual TLS which is only presented to the registry receiving the command line
+// credentials, never to source registries or mirrors. Per-registry certificates are read
+// from the <host[:port]> subdirectory of each of the CertsDirs: "*.crt" files are trusted
+// CAs and "*.cert" files client certificates, each with a matching "*.key" file; client
+// certificates found there replace the global client certificate for that registry.
+type TLSOptions struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	CertsDirs  []string
+}
+
+var (
+	tlsOptionsLock sync.RWMutex
+	tlsOptions     = TLSOptions{CertsDirs: DefaultCertsDirs}
+)
+
+// SetTLSOptions sets the TLS settings used by registry hosts created afterwards
+func SetTLSOptions(opts TLSOptions) error {
+	if (opts.ClientCert == "") != (opts.ClientKey == "") {
+		return fmt.Errorf("a client certificate and its key must be provided together")
+	}
+	tlsOptionsLock.Lock()
+	tlsOptions = opts
+	tlsOptionsLock.Unlock()
+	return nil
+}
+
+// tlsConfig returns the TLS client configuration for a registry hostname, or nil if the
+// default configuration applies; the global client certificate is only included when
+// clientCert is set and the certificates directories hold none for the hostname
+func tlsConfig(hostname string, insecure, clientCert bool) (*tls.Config, error) {
+	tlsOptionsLock.RLock()
+	opts := tlsOptions
+	tlsOptionsLock.RUnlock()
+
+	var (
+		caFiles     []string
+		clientPairs [][2]string
+	)
+	if opts.CACert != "" {
+		caFiles = append(caFiles, opts.CACert)
+	}
+	for _, dir := range opts.CertsDirs {
+		hostDir := filepath.Join(dir, hostname)
+		entries, err := os.ReadDir(hostDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to read certificates directory %s: %v", hostDir, err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			switch filepath.Ext(name) {
+			case ".crt":
+				caFiles = append(caFiles, filepath.Join(hostDir, name))
+			case ".cert":
+				keyName := strings.TrimSuffix(name, ".cert") + ".key"
+				if _, err := os.Stat(filepath.Join(hostDir, keyName)); err != nil {
+					return nil, fmt.Errorf("missing key %s for client certificate %s in %s", keyName, name, hostDir)
+				}
+				clientPairs = append(clientPairs, [2]string{filepath.Join(hostDir, name), filepath.Join(hostDir, keyName)})
+			}
+		}
+	}
+	if clientCert && opts.ClientCert != "" && len(clientPairs) == 0 {
+		clientPairs = append(clientPairs, [2]string{opts.ClientCert, opts.ClientKey})
+	}
+	if !insecure && len(caFiles) == 0 && len(clientPairs) == 0 {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if len(caFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, caFile := range caFiles {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read CA certificate: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM encoded CA certificates found in %s", caFile)
+			}
+		}
+		config.RootCAs = pool
+	}
+	for _, pair := range clientPairs {
+		cert, err := tls.LoadX509KeyPair(pair[0], pair[1])
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate %s: %v", pair[0], err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	return config, nil
+}
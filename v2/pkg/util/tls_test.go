@@ -0,0 +1,252 @@
+package util
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+)
+
+// writeTestCert writes a self-signed PEM certificate and its key to the given paths
+func writeTestCert(t *testing.T, certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keyPath == "" {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfigCertsDir(t *testing.T) {
+	certsDir := t.TempDir()
+	hostDir := filepath.Join(certsDir, "myregistry:5000")
+	if err := os.Mkdir(hostDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCert(t, filepath.Join(hostDir, "ca.crt"), "")
+	writeTestCert(t, filepath.Join(hostDir, "client.cert"), filepath.Join(hostDir, "client.key"))
+
+	defer func() {
+		_ = SetTLSOptions(TLSOptions{CertsDirs: DefaultCertsDirs})
+	}()
+	if err := SetTLSOptions(TLSOptions{CertsDirs: []string{certsDir}}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := tlsConfig("myregistry:5000", false, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config == nil || config.RootCAs == nil {
+		t.Fatalf("expected CA certificates from %s to be trusted", hostDir)
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("expected 1 client certificate, got %d", len(config.Certificates))
+	}
+
+	// other registries keep the default configuration
+	config, err = tlsConfig("otherregistry", false, true)
+	if err != nil || config != nil {
+		t.Fatalf("expected default TLS configuration for other registry, got %v (err: %v)", config, err)
+	}
+	config, err = tlsConfig("otherregistry", true, true)
+	if err != nil || config == nil || !config.InsecureSkipVerify {
+		t.Fatalf("expected insecure TLS configuration, got %v (err: %v)", config, err)
+	}
+
+	// a client certificate without its key is an error
+	if err := os.Remove(filepath.Join(hostDir, "client.key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tlsConfig("myregistry:5000", false, true); err == nil {
+		t.Fatal("expected error for client certificate without key")
+	}
+}
+
+func TestSetTLSOptionsClientKeyPair(t *testing.T) {
+	if err := SetTLSOptions(TLSOptions{ClientCert: "client.cert"}); err == nil {
+		t.Fatal("expected error for client certificate without key")
+	}
+	if err := SetTLSOptions(TLSOptions{ClientKey: "client.key"}); err == nil {
+		t.Fatal("expected error for client key without certificate")
+	}
+}
+
+// clientCertificates returns the client certificates presented by the endpoints of a registry
+func clientCertificates(t *testing.T, hostname string) [][]tls.Certificate {
+	hosts, err := getHosts(hostname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certs [][]tls.Certificate
+	for _, host := range hosts {
+		transport := host.Client.Transport
+		if fallback, ok := transport.(docker.HTTPFallback); ok {
+			transport = fallback.RoundTripper
+		}
+		retry, ok := transport.(*retryTransport)
+		if !ok {
+			t.Fatalf("unexpected transport type %T", transport)
+		}
+		var hostCerts []tls.Certificate
+		if retry.transport.TLSClientConfig != nil {
+			hostCerts = retry.transport.TLSClientConfig.Certificates
+		}
+		certs = append(certs, hostCerts)
+	}
+	return certs
+}
+
+func TestClientCertScope(t *testing.T) {
+	dir := t.TempDir()
+	globalCert, globalKey := filepath.Join(dir, "global.cert"), filepath.Join(dir, "global.key")
+	writeTestCert(t, globalCert, globalKey)
+	certsDir := filepath.Join(dir, "certs.d")
+	hostDir := filepath.Join(certsDir, "myregistry:5000")
+	if err := os.MkdirAll(hostDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCert(t, filepath.Join(hostDir, "client.cert"), filepath.Join(hostDir, "client.key"))
+	hostPair, err := tls.LoadX509KeyPair(filepath.Join(hostDir, "client.cert"), filepath.Join(hostDir, "client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globalPair, err := tls.LoadX509KeyPair(globalCert, globalKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confPath := filepath.Join(dir, "registries.conf")
+	conf := `
+[[registry]]
+prefix = "target.example.com"
+[[registry.mirror]]
+location = "mirror.example.com"
+
+[[registry]]
+prefix = "rewritten.example.com"
+location = "registry.example.net/rewritten"
+[[registry.mirror]]
+location = "mirror.example.com"
+`
+	if err := os.WriteFile(confPath, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hostsDir := filepath.Join(dir, "hosts")
+	hostsTomls := map[string]string{
+		"hosted.example.com": `
+server = "https://hosted.example.com"
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+`,
+		// a client certificate configured for the server in hosts.toml is kept
+		"ownclient.example.com": `
+server = "https://ownclient.example.com"
+client = [["` + filepath.Join(hostDir, "client.cert") + `", "` + filepath.Join(hostDir, "client.key") + `"]]
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+`,
+	}
+	for host, hostsToml := range hostsTomls {
+		if err := os.MkdirAll(filepath.Join(hostsDir, host), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(hostsDir, host, "hosts.toml"), []byte(hostsToml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		_ = SetTLSOptions(TLSOptions{CertsDirs: DefaultCertsDirs})
+		_ = SetMirrorOptions(MirrorOptions{})
+	}()
+	if err := SetTLSOptions(TLSOptions{ClientCert: globalCert, ClientKey: globalKey, CertsDirs: []string{certsDir}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMirrorOptions(MirrorOptions{HostsDir: hostsDir, RegistriesConf: confPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	sameCert := func(certs []tls.Certificate, expected tls.Certificate) bool {
+		return len(certs) == 1 && bytes.Equal(certs[0].Certificate[0], expected.Certificate[0])
+	}
+	var tests = []struct {
+		name     string
+		source   bool
+		expected []*tls.Certificate
+	}{
+		// the global certificate is only presented to the target registry, not its mirrors
+		{name: "target.example.com", expected: []*tls.Certificate{nil, &globalPair}},
+		{name: "target.example.com", source: true, expected: []*tls.Certificate{nil, nil}},
+		{name: "rewritten.example.com", expected: []*tls.Certificate{nil, &globalPair}},
+		{name: "rewritten.example.com", source: true, expected: []*tls.Certificate{nil, nil}},
+		{name: "hosted.example.com", expected: []*tls.Certificate{nil, &globalPair}},
+		{name: "hosted.example.com", source: true, expected: []*tls.Certificate{nil, nil}},
+		{name: "ownclient.example.com", expected: []*tls.Certificate{nil, &hostPair}},
+		// certificates from the certificates directory replace the global certificate
+		{name: "myregistry:5000", expected: []*tls.Certificate{&hostPair}},
+		{name: "myregistry:5000", source: true, expected: []*tls.Certificate{&hostPair}},
+	}
+	for _, test := range tests {
+		ref, err := reference.ParseNormalizedNamed(test.name + "/image:tag")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.source {
+			err = CreateSourceRegistryHost(ref, false, false, "")
+		} else {
+			err = CreateRegistryHost(ref, "", "", false, false, "", true)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs := clientCertificates(t, test.name)
+		if len(certs) != len(test.expected) {
+			t.Fatalf("%s (source %v): expected %d endpoints, got %d", test.name, test.source, len(test.expected), len(certs))
+		}
+		for i, expected := range test.expected {
+			if expected == nil && len(certs[i]) != 0 {
+				t.Errorf("%s (source %v): endpoint %d: expected no client certificate, got %d", test.name, test.source, i, len(certs[i]))
+			}
+			if expected != nil && !sameCert(certs[i], *expected) {
+				t.Errorf("%s (source %v): endpoint %d: unexpected client certificates", test.name, test.source, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package util
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TransportOptions holds the HTTP transport settings used for all registry connections.
+// A zero timeout disables that timeout. Proxies are configured with the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables. Requests failing with a transient error
+// are retried up to MaxRetries times, waiting from RetryBackoff up to RetryMaxBackoff.
+type TransportOptions struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	DisableHTTP2          bool
+	MaxRetries            int
+	RetryBackoff          time.Duration
+	RetryMaxBackoff       time.Duration
+}
+
+// DefaultTransportOptions are the transport settings used unless others are provided
+var DefaultTransportOptions = TransportOptions{
+	DialTimeout:         30 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+	IdleConnTimeout:     90 * time.Second,
+	MaxIdleConnsPerHost: 10,
+	MaxRetries:          3,
+	RetryBackoff:        time.Second,
+	RetryMaxBackoff:     30 * time.Second,
+}
+
+var (
+	transportOptionsLock sync.RWMutex
+	transportOptions     = DefaultTransportOptions
+)
+
+// SetTransportOptions sets the HTTP transport settings used by registry hosts created afterwards
+func SetTransportOptions(opts TransportOptions) error {
+	if opts.DialTimeout < 0 || opts.TLSHandshakeTimeout < 0 || opts.ResponseHeaderTimeout < 0 || opts.IdleConnTimeout < 0 {
+		return fmt.Errorf("transport timeouts cannot be negative")
+	}
+	if opts.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("the maximum number of idle connections per host cannot be negative")
+	}
+	if opts.MaxRetries < 0 || opts.RetryBackoff < 0 || opts.RetryMaxBackoff < 0 {
+		return fmt.Errorf("retry settings cannot be negative")
+	}
+	if opts.RetryBackoff > opts.RetryMaxBackoff {
+		return fmt.Errorf("the retry backoff %s cannot exceed the maximum retry backoff %s", opts.RetryBackoff, opts.RetryMaxBackoff)
+	}
+	transportOptionsLock.Lock()
+	transportOptions = opts
+	transportOptionsLock.Unlock()
+	return nil
+}
+
+// newClient returns a dedicated HTTP client for a registry host using the transport
+// settings and the provided TLS configuration, if any
+func newClient(tlsConf *tls.Config) *http.Client {
+	transportOptionsLock.RLock()
+	opts := transportOptions
+	transportOptionsLock.RUnlock()
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConf,
+	}
+	if opts.DisableHTTP2 {
+		// a non-nil empty map keeps the transport from upgrading TLS connections to HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if opts.MaxRetries == 0 {
+		return &http.Client{
+			Transport: transport,
+		}
+	}
+	return &http.Client{
+		Transport: &retryTransport{
+			transport:  transport,
+			maxRetries: opts.MaxRetries,
+			backoff:    opts.RetryBackoff,
+			maxBackoff: opts.RetryMaxBackoff,
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+)
+
+func TestCreateRegistryHostClient(t *testing.T) {
+	defaultTransport := http.DefaultClient.Transport
+	ref, err := reference.ParseNormalizedNamed("myregistry:5000/image:tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRegistryHost(ref, "", "", true, false, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if http.DefaultClient.Transport != defaultTransport {
+		t.Fatal("http.DefaultClient must not be modified")
+	}
+	host, err := GetRegistryHost("myregistry:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Client == http.DefaultClient {
+		t.Fatal("expected a dedicated client for the registry host")
+	}
+	retry, ok := host.Client.Transport.(*retryTransport)
+	if !ok {
+		t.Fatalf("unexpected transport type %T", host.Client.Transport)
+	}
+	transport := retry.transport
+	if transport.TLSClientConfig == nil || !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("expected insecure TLS configuration")
+	}
+	if transport.Proxy == nil {
+		t.Fatal("expected proxy configuration from the environment")
+	}
+	if !transport.ForceAttemptHTTP2 {
+		t.Fatal("expected HTTP/2 to be enabled by default")
+	}
+}
+
+func TestNewClientDisableHTTP2(t *testing.T) {
+	defer func() {
+		_ = SetTransportOptions(DefaultTransportOptions)
+	}()
+	opts := DefaultTransportOptions
+	opts.DisableHTTP2 = true
+	// without retries the client uses the HTTP transport directly
+	opts.MaxRetries = 0
+	if err := SetTransportOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	transport := newClient(nil).Transport.(*http.Transport)
+	if transport.ForceAttemptHTTP2 || transport.TLSNextProto == nil {
+		t.Fatal("expected HTTP/2 to be disabled")
+	}
+
+	opts.DialTimeout = -1
+	if err := SetTransportOptions(opts); err == nil {
+		t.Fatal("expected error for negative timeout")
+	}
+}